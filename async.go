@@ -0,0 +1,325 @@
+package srslog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCloseTimeout is how long Close waits for an asynchronous Writer to
+// send its queued messages, see WithCloseTimeout.
+const DefaultCloseTimeout = 5 * time.Second
+
+var (
+	// ErrQueueFull is returned by writes to an asynchronous Writer whose
+	// queue is full and whose Overflow policy dropped the message.
+	ErrQueueFull = errors.New("srslog: queue full, message dropped")
+
+	// ErrClosed is returned by writes to an asynchronous Writer that has
+	// been closed.
+	ErrClosed = errors.New("srslog: writer closed")
+)
+
+// Overflow decides what an asynchronous Writer does with a message when
+// its queue is full.
+type Overflow int
+
+const (
+	// OverflowBlock makes writes wait for room in the queue.
+	OverflowBlock Overflow = iota
+
+	// OverflowDropNewest drops the message being written.
+	OverflowDropNewest
+
+	// OverflowDropOldest drops the oldest queued message to make room.
+	OverflowDropOldest
+
+	// OverflowDropBySeverity never drops LOG_EMERG, LOG_ALERT and LOG_CRIT
+	// messages. Other messages are dropped when the queue is full; to make
+	// room for a message of one of those severities, the oldest queued
+	// message of another severity is dropped, and if there is none the
+	// write waits.
+	OverflowDropBySeverity
+)
+
+// WithAsync makes the Writer queue up to size messages in memory and send
+// them from a background goroutine, so writes no longer wait for the
+// network or for reconnects. overflow decides what happens when the queue
+// is full. Messages are timestamped when they are written and formatted
+// when they are sent. Errors from sending are passed to the handler set with
+// WithAsyncErrorHandler, if any.
+func WithAsync(size int, overflow Overflow) Option {
+	return func(w *Writer) error {
+		if size < 1 {
+			size = 1
+		}
+		w.async = &asyncQueue{size: size, overflow: overflow, changed: make(chan struct{})}
+		return nil
+	}
+}
+
+// WithAsyncErrorHandler sets a function that is called with the error of
+// each message an asynchronous Writer fails to send.
+func WithAsyncErrorHandler(handler func(error)) Option {
+	return func(w *Writer) error {
+		w.asyncErrorHandler = handler
+		return nil
+	}
+}
+
+// WithCloseTimeout sets how long Close waits for an asynchronous Writer to
+// send the messages still in its queue. Messages left after that are
+// dropped. It defaults to DefaultCloseTimeout.
+func WithCloseTimeout(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.closeTimeout = d
+		return nil
+	}
+}
+
+// asyncQueue is the queue of an asynchronous Writer.
+type asyncQueue struct {
+	size     int
+	overflow Overflow
+	dropped  atomic.Uint64
+
+	mu       sync.Mutex
+	items    []Message
+	inflight bool
+	closed   bool          // no more writes are accepted
+	changed  chan struct{} // closed and replaced whenever the above change
+
+	cancel context.CancelFunc // interrupts the sender
+	done   chan struct{}      // closed when the sender has exited
+}
+
+// startAsync starts the background sender of an asynchronous Writer.
+func (w *Writer) startAsync() {
+	q := w.async
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+	go w.sendAsync(ctx)
+}
+
+// sendAsync sends queued messages until the queue is closed and empty, or
+// ctx is cancelled.
+func (w *Writer) sendAsync(ctx context.Context) {
+	q := w.async
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 {
+			if q.closed {
+				q.mu.Unlock()
+				return
+			}
+			changed := q.changed
+			q.mu.Unlock()
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+			q.mu.Lock()
+		}
+		if w.batchSize > 1 {
+			q.fillLocked(ctx, w.batchSize, w.batchDelay)
+		}
+		n := 1
+		if w.batchSize > 1 {
+			n = min(len(q.items), w.batchSize)
+		}
+		items := append([]Message(nil), q.items[:n]...)
+		q.items = q.items[n:]
+		q.inflight = true
+		q.broadcastLocked()
+		q.mu.Unlock()
+
+		var err error
+		if len(items) == 1 {
+			_, err = w.deliver(ctx, items[0])
+		} else {
+			err = w.deliverBatch(ctx, items)
+		}
+		if err != nil && w.asyncErrorHandler != nil {
+			w.asyncErrorHandler(err)
+		}
+
+		q.mu.Lock()
+		q.inflight = false
+		q.broadcastLocked()
+		q.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// fillLocked waits up to delay for the queue to hold size messages, unless
+// it is closed.
+func (q *asyncQueue) fillLocked(ctx context.Context, size int, delay time.Duration) {
+	if len(q.items) >= size || q.closed || delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for len(q.items) < size && !q.closed {
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			q.mu.Lock()
+			return
+		case <-ctx.Done():
+			q.mu.Lock()
+			return
+		}
+		q.mu.Lock()
+	}
+}
+
+func (q *asyncQueue) broadcastLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// enqueue adds a message to the queue, applying the overflow policy if it
+// is full.
+func (q *asyncQueue) enqueue(ctx context.Context, m Message) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return 0, ErrClosed
+		}
+		if len(q.items) < q.size {
+			break
+		}
+
+		wait := false
+		switch q.overflow {
+		case OverflowDropNewest:
+			q.dropped.Add(1)
+			return 0, ErrQueueFull
+		case OverflowDropOldest:
+			q.items = q.items[1:]
+			q.dropped.Add(1)
+		case OverflowDropBySeverity:
+			if !neverDropped(m.Priority) {
+				q.dropped.Add(1)
+				return 0, ErrQueueFull
+			}
+			wait = !q.dropOldestDroppableLocked()
+		default:
+			wait = true
+		}
+		if !wait {
+			break
+		}
+
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			q.mu.Lock()
+			return 0, contextErr(ctx)
+		}
+		q.mu.Lock()
+	}
+
+	q.items = append(q.items, m)
+	q.broadcastLocked()
+	return len(m.Content), nil
+}
+
+// neverDropped reports whether OverflowDropBySeverity keeps messages of
+// priority p.
+func neverDropped(p Priority) bool {
+	return p&severityMask <= LOG_CRIT
+}
+
+// dropOldestDroppableLocked drops the oldest queued message that
+// OverflowDropBySeverity may drop, and reports whether there was one.
+func (q *asyncQueue) dropOldestDroppableLocked() bool {
+	for i, item := range q.items {
+		if !neverDropped(item.Priority) {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.dropped.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+// flush waits until every queued message has been sent, or ctx is done.
+func (q *asyncQueue) flush(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) > 0 || q.inflight {
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			q.mu.Lock()
+			return contextErr(ctx)
+		}
+		q.mu.Lock()
+	}
+	return nil
+}
+
+// close stops accepting writes and waits up to timeout for the queue to
+// drain. Messages still queued after that are dropped.
+func (q *asyncQueue) close(timeout time.Duration) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.done
+		return
+	}
+	q.closed = true
+	q.broadcastLocked()
+	q.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-q.done:
+	case <-timer.C:
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+
+	q.mu.Lock()
+	q.dropped.Add(uint64(len(q.items)))
+	q.items = nil
+	q.broadcastLocked()
+	q.mu.Unlock()
+}
+
+// Flush waits until an asynchronous Writer has sent every message queued so
+// far, or ctx is done. It returns at once for other Writers.
+func (w *Writer) Flush(ctx context.Context) error {
+	w = w.root()
+	if w.async == nil {
+		return nil
+	}
+	return w.async.flush(ctx)
+}
+
+// Dropped returns the number of messages an asynchronous Writer has dropped
+// because its queue was full or it was closed before sending them.
+func (w *Writer) Dropped() uint64 {
+	w = w.root()
+	if w.async == nil {
+		return 0
+	}
+	return w.async.dropped.Load()
+}
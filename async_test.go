@@ -0,0 +1,211 @@
+package srslog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestQueue(size int, overflow Overflow) *asyncQueue {
+	return &asyncQueue{size: size, overflow: overflow, changed: make(chan struct{})}
+}
+
+func queued(q *asyncQueue) string {
+	var msgs []string
+	for _, item := range q.items {
+		msgs = append(msgs, item.Content)
+	}
+	return strings.Join(msgs, ",")
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	bg := context.Background()
+	expired, cancel := context.WithTimeout(bg, 20*time.Millisecond)
+	defer cancel()
+
+	q := newTestQueue(2, OverflowBlock)
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "a"})
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "b"})
+	if _, err := q.enqueue(expired, Message{Priority: LOG_INFO, Content: "c"}); err != context.DeadlineExceeded {
+		t.Errorf("OverflowBlock: expected the write to wait, got %v", err)
+	}
+
+	q = newTestQueue(2, OverflowDropNewest)
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "a"})
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "b"})
+	if _, err := q.enqueue(bg, Message{Priority: LOG_INFO, Content: "c"}); err != ErrQueueFull || queued(q) != "a,b" {
+		t.Errorf("OverflowDropNewest: got %v with %q", err, queued(q))
+	}
+
+	q = newTestQueue(2, OverflowDropOldest)
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "a"})
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "b"})
+	if _, err := q.enqueue(bg, Message{Priority: LOG_INFO, Content: "c"}); err != nil || queued(q) != "b,c" {
+		t.Errorf("OverflowDropOldest: got %v with %q", err, queued(q))
+	}
+	if q.dropped.Load() != 1 {
+		t.Errorf("expected one dropped message, got %d", q.dropped.Load())
+	}
+
+	q = newTestQueue(2, OverflowDropBySeverity)
+	q.enqueue(bg, Message{Priority: LOG_CRIT, Content: "crit"})
+	q.enqueue(bg, Message{Priority: LOG_INFO, Content: "info"})
+	if _, err := q.enqueue(bg, Message{Priority: LOG_ERR, Content: "err"}); err != ErrQueueFull {
+		t.Errorf("OverflowDropBySeverity: expected LOG_ERR to be dropped, got %v", err)
+	}
+	if _, err := q.enqueue(bg, Message{Priority: LOG_ALERT, Content: "alert"}); err != nil || queued(q) != "crit,alert" {
+		t.Errorf("OverflowDropBySeverity: expected LOG_INFO to make room, got %v with %q", err, queued(q))
+	}
+	if _, err := q.enqueue(expired, Message{Priority: LOG_EMERG, Content: "emerg"}); err != context.DeadlineExceeded {
+		t.Errorf("OverflowDropBySeverity: expected LOG_EMERG to wait, got %v", err)
+	}
+}
+
+func TestAsyncWriterDelivers(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithAsync(10, OverflowBlock))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	for _, msg := range []string{"one", "two", "three"} {
+		if n, err := w.Write([]byte(msg)); err != nil || n != len(msg) {
+			t.Fatalf("failed to queue %q: %d, %v", msg, n, err)
+		}
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	w.async.mu.Lock()
+	if len(w.async.items) != 0 || w.async.inflight {
+		t.Errorf("the queue should be empty after Flush")
+	}
+	w.async.mu.Unlock()
+	s.receive(t, "one")
+	s.receive(t, "two")
+	s.receive(t, "three")
+}
+
+func TestAsyncCloseDrains(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithAsync(100, OverflowBlock))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		w.Info("queued")
+	}
+	w.Err("last")
+	w.Close()
+	s.receive(t, "last")
+
+	if err := w.Err("after close"); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestAsyncCloseTimeout(t *testing.T) {
+	l := startSilentServer(t, "tcp", "127.0.0.1:0")
+	defer l.Close()
+
+	w, err := DialWithOptions("tcp", l.Addr().String(), LOG_ERR, "tag",
+		WithAsync(10, OverflowBlock), WithCloseTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	// Large enough to fill the socket buffers of a server that never reads.
+	big := strings.Repeat("x", 4<<20)
+	for i := 0; i < 5; i++ {
+		w.Info(big)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected Flush to time out, got %v", err)
+	}
+
+	start := time.Now()
+	w.Close()
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Close should give up after the close timeout")
+	}
+	if w.Dropped() == 0 {
+		t.Errorf("expected the unsent messages to be counted as dropped")
+	}
+}
+
+func TestAsyncErrorHandler(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+
+	errs := make(chan error, 10)
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag",
+		WithAsync(10, OverflowBlock), WithAsyncErrorHandler(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	breakConn(t, w, s)
+	if err := w.Err("unsendable"); err != nil {
+		t.Fatalf("queueing should not fail: %v", err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the error handler was not called")
+	}
+}
+
+func TestFlushSyncWriter(t *testing.T) {
+	w := &Writer{}
+	if err := w.Flush(context.Background()); err != nil || w.Dropped() != 0 {
+		t.Errorf("Flush and Dropped should be no-ops for a synchronous Writer")
+	}
+}
+
+func TestAsyncKeepsWriteTime(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithAsync(10, OverflowBlock))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	release := make(chan struct{})
+	w.SetMessageFormatter(func(m *Message) string {
+		if m.Content == "first\n" {
+			<-release
+		}
+		return m.Timestamp.Format(time.RFC3339Nano) + " " + m.Content
+	})
+
+	w.Err("first")
+	written := time.Now()
+	w.Err("second")
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	s.receiveNext(t, "first")
+	select {
+	case m := <-s.msgs:
+		stamp, err := time.Parse(time.RFC3339Nano, strings.Fields(m)[0])
+		if err != nil {
+			t.Fatalf("unexpected message %q", m)
+		}
+		if stamp.Sub(written) > 50*time.Millisecond {
+			t.Errorf("expected the time of the write, got %v after it", stamp.Sub(written))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the second message")
+	}
+}
@@ -0,0 +1,233 @@
+package srslog
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+)
+
+// batchWriter is implemented by connections that can send several
+// messages with fewer system calls than writing them one by one.
+type batchWriter interface {
+	// writeBatch sends msgs in order and returns how many were sent
+	// completely. The headers of msgs are already resolved.
+	writeBatch(ctx context.Context, framer Framer, formatter MessageFormatter, msgs []Message) (int, error)
+}
+
+// WithBatching makes an asynchronous Writer send its queue in batches: the
+// sender waits up to delay after taking a message for more to arrive, and
+// sends up to size messages at once. It has no effect without WithAsync.
+func WithBatching(size int, delay time.Duration) Option {
+	return func(w *Writer) error {
+		if size < 1 {
+			size = 1
+		}
+		w.batchSize = size
+		w.batchDelay = delay
+		return nil
+	}
+}
+
+// WriteBatch sends msgs in order, using as few system calls as the
+// transport allows: one writev(2) on TCP, one sendmmsg(2) on UDP where
+// available, and as few records as possible on TLS. Each message is framed
+// on its own, and sent as its own datagram on datagram transports. If a
+// message cannot be sent, WriteBatch reconnects and retries once from that
+// message, like the other writes. An asynchronous Writer only queues the
+// messages.
+func (w *Writer) WriteBatch(msgs []Message) error {
+	return w.WriteBatchContext(context.Background(), msgs)
+}
+
+// WriteBatchContext is WriteBatch bounded by ctx.
+func (w *Writer) WriteBatchContext(ctx context.Context, msgs []Message) error {
+	if w.parent != nil {
+		stamped := make([]Message, len(msgs))
+		for i, m := range msgs {
+			stamped[i] = w.stamp(m)
+		}
+		return w.parent.WriteBatchContext(ctx, stamped)
+	}
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	allowed := make([]Message, 0, len(msgs))
+	for i := range msgs {
+		if err := w.checkOverrides(&msgs[i]); err != nil {
+			return err
+		}
+	}
+	for _, m := range msgs {
+		if w.enabled(m.Priority) && (w.limiter == nil || w.allowRate(m.Priority, w.tagOf(m), m.Content)) {
+			w.capture(&m)
+			allowed = append(allowed, m)
+		}
+	}
+	msgs = allowed
+	if w.repeats != nil {
+		msgs = w.filterRepeats(msgs)
+	}
+	if w.async != nil {
+		for _, m := range msgs {
+			if _, err := w.async.enqueue(ctx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return w.deliverBatch(ctx, msgs)
+}
+
+// deliverBatch sends msgs, or appends them to the spool like deliver.
+func (w *Writer) deliverBatch(ctx context.Context, msgs []Message) error {
+	if w.spool != nil && w.spool.pending() > 0 {
+		return w.spoolBatch(ctx, msgs)
+	}
+	n, err := w.sendBatch(ctx, msgs)
+	if err != nil && w.spool != nil && contextErr(ctx) == nil {
+		return w.spoolBatch(ctx, msgs[n:])
+	}
+	return err
+}
+
+// spoolBatch appends msgs to the spool, and writes those that cannot be
+// spooled to the circuit breaker's fallback, if any.
+func (w *Writer) spoolBatch(ctx context.Context, msgs []Message) error {
+	for i, m := range msgs {
+		if _, err := w.spoolMessage(m); err != nil {
+			_, err = w.writeFallbackBatch(ctx, msgs[i:], err)
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBatchAndRetry writes msgs, reconnecting and retrying once from the
+// first message that was not sent. It returns how many messages were sent.
+func (w *Writer) sendBatchAndRetry(ctx context.Context, msgs []Message) (int, error) {
+	if err := contextErr(ctx); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	conn := w.getConn()
+	if conn != nil {
+		n, err := w.writeBatch(ctx, conn, msgs)
+		sent += n
+		if err == nil {
+			return sent, nil
+		}
+		if contextErr(ctx) != nil {
+			return sent, w.abandon(ctx, conn)
+		}
+	}
+
+	conn, err := w.redial(ctx, conn)
+	if err != nil {
+		return sent, err
+	}
+	n, err := w.writeBatch(ctx, conn, msgs[sent:])
+	sent += n
+	if err != nil && contextErr(ctx) != nil {
+		return sent, w.abandon(ctx, conn)
+	}
+	return sent, err
+}
+
+// writeBatch writes msgs on conn, all at once if conn supports it.
+func (w *Writer) writeBatch(ctx context.Context, conn serverConn, msgs []Message) (int, error) {
+	// ensure they end in a \n
+	terminated := make([]Message, len(msgs))
+	for i, m := range msgs {
+		m = w.resolve(m)
+		if !strings.HasSuffix(m.Content, "\n") {
+			m.Content += "\n"
+		}
+		terminated[i] = m
+	}
+
+	if bw, ok := conn.(batchWriter); ok {
+		return bw.writeBatch(ctx, w.framer, w.formatter, terminated)
+	}
+	for i := range terminated {
+		if err := conn.writeString(ctx, w.framer, w.formatter, &terminated[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(terminated), nil
+}
+
+// writeBatch sends msgs with a single vectored write on TCP and Unix
+// stream sockets, a single write on TLS, and sendmmsg(2) on UDP.
+func (n *netConn) writeBatch(ctx context.Context, framer Framer, formatter MessageFormatter, msgs []Message) (int, error) {
+	if framer == nil {
+		framer = DefaultFramer
+	}
+	if formatter == nil {
+		formatter = DefaultMessageFormatter
+	}
+	bufs := make([][]byte, len(msgs))
+	for i := range msgs {
+		bufs[i] = []byte(framer(formatter(&msgs[i])))
+	}
+	select {
+	case <-n.gone:
+		return 0, errServerClosed
+	default:
+	}
+	defer setWriteDeadline(ctx, n.conn, n.writeTimeout)()
+
+	switch c := n.conn.(type) {
+	case *net.UDPConn:
+		return sendDatagrams(c, bufs)
+	case *net.TCPConn:
+		return writeBuffers(c, bufs)
+	case *net.UnixConn:
+		if c.LocalAddr() != nil && c.LocalAddr().Network() == "unix" {
+			return writeBuffers(c, bufs)
+		}
+	case *tls.Conn:
+		// One write lets TLS pack the messages into as few records as
+		// possible.
+		var joined []byte
+		for _, b := range bufs {
+			joined = append(joined, b...)
+		}
+		written, err := c.Write(joined)
+		return sentMessages(bufs, int64(written)), err
+	}
+	return writeEach(n.conn, bufs)
+}
+
+// writeBuffers writes bufs to a stream socket with writev(2).
+func writeBuffers(c net.Conn, bufs [][]byte) (int, error) {
+	// WriteTo consumes the buffers it is given.
+	v := append(net.Buffers(nil), bufs...)
+	written, err := v.WriteTo(c)
+	return sentMessages(bufs, written), err
+}
+
+// writeEach writes each of bufs with its own write, which keeps them
+// separate datagrams on datagram sockets.
+func writeEach(c net.Conn, bufs [][]byte) (int, error) {
+	for i, b := range bufs {
+		if _, err := c.Write(b); err != nil {
+			return i, err
+		}
+	}
+	return len(bufs), nil
+}
+
+// sentMessages returns how many of bufs fit completely in the first
+// written bytes.
+func sentMessages(bufs [][]byte, written int64) int {
+	for i, b := range bufs {
+		if written < int64(len(b)) {
+			return i
+		}
+		written -= int64(len(b))
+	}
+	return len(bufs)
+}
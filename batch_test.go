@@ -0,0 +1,161 @@
+package srslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testBatch = []Message{
+	{Priority: LOG_ERR, Content: "one"},
+	{Priority: LOG_WARNING, Content: "two\n"},
+	{Priority: LOG_INFO, Content: "three"},
+}
+
+func TestWriteBatchFraming(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	for _, network := range []string{"tcp", "tcp+tls"} {
+		t.Run(network, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			if network == "tcp+tls" {
+				l = tls.NewListener(l, serverConfig)
+			}
+			defer l.Close()
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				c, err := l.Accept()
+				if err == nil {
+					// Complete the TLS handshake, if any.
+					c.Read(nil)
+					accepted <- c
+				}
+			}()
+
+			w, err := DialWithTLSConfig(network, l.Addr().String(), LOG_ERR, "tag", clientConfig)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer w.Close()
+			w.SetFramer(RFC5425MessageLengthFramer)
+
+			var c net.Conn
+			select {
+			case c = <-accepted:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("the connection was not accepted")
+			}
+			defer c.Close()
+
+			if err := w.WriteBatch(testBatch); err != nil {
+				t.Fatalf("failed to write batch: %v", err)
+			}
+
+			r := bufio.NewReader(c)
+			for _, m := range testBatch {
+				var length int
+				if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+					t.Fatalf("failed to read the message length: %v", err)
+				}
+				frame := make([]byte, length)
+				if _, err := io.ReadFull(r, frame); err != nil {
+					t.Fatalf("failed to read the message: %v", err)
+				}
+				want := fmt.Sprintf("<%d>", m.Priority)
+				if !strings.HasPrefix(string(frame), want) || !strings.HasSuffix(string(frame), strings.TrimSuffix(m.Content, "\n")+"\n") {
+					t.Errorf("unexpected frame %q for %+v", frame, m)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteBatchUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	w, err := Dial("udp", pc.LocalAddr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.WriteBatch(testBatch); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	for _, m := range testBatch {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("failed to read a datagram: %v", err)
+		}
+		got := string(buf[:n])
+		if strings.Count(got, "\n") != 1 || !strings.HasSuffix(got, strings.TrimSuffix(m.Content, "\n")+"\n") {
+			t.Errorf("expected one message per datagram, got %q", got)
+		}
+	}
+}
+
+func TestWriteBatchReconnects(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	breakConn(t, w, s)
+	s = startTestStreamServer(t, s.addr)
+	defer s.kill()
+	if err := w.WriteBatch(testBatch); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	s.receive(t, "one")
+	s.receive(t, "two")
+	s.receive(t, "three")
+}
+
+func TestAsyncBatching(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag",
+		WithAsync(100, OverflowBlock), WithBatching(10, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 25; i++ {
+		w.Info(fmt.Sprintf("message %d", i))
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		s.receive(t, fmt.Sprintf("message %d\n", i))
+	}
+}
+
+func TestSentMessages(t *testing.T) {
+	bufs := [][]byte{[]byte("aaa"), []byte("bb"), []byte("c")}
+	for written, want := range []int{0, 0, 0, 1, 1, 2, 3} {
+		if got := sentMessages(bufs, int64(written)); got != want {
+			t.Errorf("%d bytes written: expected %d messages, got %d", written, want, got)
+		}
+	}
+}
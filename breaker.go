@@ -0,0 +1,260 @@
+package srslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is the number of consecutive failed writes
+	// that opens a circuit breaker, see WithCircuitBreaker.
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerOpenTimeout is how long a circuit breaker stays open
+	// before it lets a write test the connection, see WithCircuitBreaker.
+	DefaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned by writes while a Writer's circuit breaker is
+// open and it has no fallback.
+var ErrCircuitOpen = errors.New("srslog: circuit breaker open")
+
+// BreakerState is the state of a Writer's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed sends messages to the destination.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen sends messages to the fallback without trying the
+	// destination.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single write test the destination, and sends
+	// the others to the fallback.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// WithCircuitBreaker gives the Writer a circuit breaker. After threshold
+// consecutive writes fail, it opens and messages go to fallback without
+// trying the destination. After openTimeout it half-opens and lets the next
+// write test the destination: if that succeeds it closes again, otherwise it
+// stays open for another openTimeout. Zero values take the defaults.
+//
+// Messages that fail while the breaker is still closed go to fallback too,
+// and writes that reach fallback succeed. fallback may be another *Writer,
+// which gets the message with its priority, or any io.Writer such as
+// os.Stderr or a file, which gets it formatted as this Writer would send it.
+// Without a fallback, writes fail with ErrCircuitOpen while it is open.
+//
+// With WithSpool, messages the breaker cannot send are spooled instead, and
+// only go to fallback if they cannot be spooled either.
+func WithCircuitBreaker(threshold int, openTimeout time.Duration, fallback io.Writer) Option {
+	return func(w *Writer) error {
+		if threshold <= 0 {
+			threshold = DefaultBreakerThreshold
+		}
+		if openTimeout <= 0 {
+			openTimeout = DefaultBreakerOpenTimeout
+		}
+		w.breaker = &breaker{threshold: threshold, openTimeout: openTimeout, fallback: fallback}
+		return nil
+	}
+}
+
+// WithBreakerStateHandler sets a function that is called whenever the
+// Writer's circuit breaker changes state.
+func WithBreakerStateHandler(handler func(from, to BreakerState)) Option {
+	return func(w *Writer) error {
+		w.breakerStateHandler = handler
+		return nil
+	}
+}
+
+// BreakerState returns the state of the Writer's circuit breaker. It is
+// BreakerClosed for a Writer without one.
+func (w *Writer) BreakerState() BreakerState {
+	w = w.root()
+	if w.breaker == nil {
+		return BreakerClosed
+	}
+	w.breaker.mu.Lock()
+	defer w.breaker.mu.Unlock()
+	return w.breaker.state
+}
+
+// breaker is the circuit breaker of a Writer.
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	fallback    io.Writer
+	fallbackMu  sync.Mutex // serializes writes to fallback
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // consecutive failed writes
+	opened   time.Time // when it last opened
+	probing  bool      // a write is testing the destination
+}
+
+// allow reports whether a write may try the destination, half-opening the
+// breaker once it has been open for openTimeout.
+func (w *Writer) allow() bool {
+	b := w.breaker
+	b.mu.Lock()
+	from := b.state
+	ok := true
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.opened) < b.openTimeout {
+			ok = false
+			break
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		ok = !b.probing
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+	w.breakerChanged(from, to)
+	return ok
+}
+
+// record updates the breaker with the result of a write that allow let
+// through. Writes interrupted by ctx don't count.
+func (w *Writer) record(ctx context.Context, err error) {
+	b := w.breaker
+	b.mu.Lock()
+	from := b.state
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.state = BreakerClosed
+	case contextErr(ctx) != nil:
+	case b.state == BreakerHalfOpen:
+		b.state = BreakerOpen
+		b.opened = time.Now()
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.opened = time.Now()
+		}
+	}
+	if from == BreakerHalfOpen {
+		b.probing = false
+	}
+	to := b.state
+	b.mu.Unlock()
+	w.breakerChanged(from, to)
+}
+
+func (w *Writer) breakerChanged(from, to BreakerState) {
+	if from != to && w.breakerStateHandler != nil {
+		w.breakerStateHandler(from, to)
+	}
+}
+
+// send sends a message through the circuit breaker, if any.
+func (w *Writer) send(ctx context.Context, m Message) (int, error) {
+	if w.breaker == nil {
+		return w.sendAndRetry(ctx, m)
+	}
+	if !w.allow() {
+		return w.fallback(ctx, m, ErrCircuitOpen)
+	}
+	n, err := w.sendAndRetry(ctx, m)
+	w.record(ctx, err)
+	if err != nil && contextErr(ctx) == nil {
+		return w.fallback(ctx, m, err)
+	}
+	return n, err
+}
+
+// sendBatch sends msgs through the circuit breaker, if any. It returns how
+// many messages were sent to the destination or the fallback.
+func (w *Writer) sendBatch(ctx context.Context, msgs []Message) (int, error) {
+	if w.breaker == nil {
+		return w.sendBatchAndRetry(ctx, msgs)
+	}
+	if !w.allow() {
+		return w.fallbackBatch(ctx, msgs, ErrCircuitOpen)
+	}
+	n, err := w.sendBatchAndRetry(ctx, msgs)
+	w.record(ctx, err)
+	if err != nil && contextErr(ctx) == nil {
+		m, err := w.fallbackBatch(ctx, msgs[n:], err)
+		return n + m, err
+	}
+	return n, err
+}
+
+// fallback writes a message that could not be sent to the fallback. It
+// returns err if there is none, or if the Writer spools such messages, in
+// which case deliver falls back only if spooling fails.
+func (w *Writer) fallback(ctx context.Context, m Message, err error) (int, error) {
+	if w.spool != nil {
+		return 0, err
+	}
+	return w.writeFallback(ctx, m, err)
+}
+
+// writeFallback writes a message to the fallback, or returns err if there
+// is none.
+func (w *Writer) writeFallback(ctx context.Context, m Message, err error) (int, error) {
+	b := w.breaker
+	if b == nil || b.fallback == nil {
+		return 0, err
+	}
+	if fw, ok := b.fallback.(*Writer); ok {
+		return fw.writeMessage(ctx, m)
+	}
+
+	m = w.resolve(m)
+	s := m.Content
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	m.Content = s
+	formatted := w.connFormatter()(&m)
+	b.fallbackMu.Lock()
+	defer b.fallbackMu.Unlock()
+	if _, err := io.WriteString(b.fallback, formatted); err != nil {
+		return 0, err
+	}
+	return len(s), nil
+}
+
+func (w *Writer) fallbackBatch(ctx context.Context, msgs []Message, err error) (int, error) {
+	if w.spool != nil {
+		return 0, err
+	}
+	return w.writeFallbackBatch(ctx, msgs, err)
+}
+
+func (w *Writer) writeFallbackBatch(ctx context.Context, msgs []Message, err error) (int, error) {
+	for i, m := range msgs {
+		if _, err := w.writeFallback(ctx, m, err); err != nil {
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
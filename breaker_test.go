@@ -0,0 +1,174 @@
+package srslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+
+	var mu sync.Mutex
+	var transitions []string
+	var fallback bytes.Buffer
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR, "tag",
+		WithCustomDialContext(d.dial),
+		WithCircuitBreaker(2, 100*time.Millisecond, &fallback),
+		WithBreakerStateHandler(func(from, to BreakerState) {
+			mu.Lock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	for _, msg := range []string{"one", "two"} {
+		if err := w.Err(msg); err != nil {
+			t.Fatalf("failed writes should go to the fallback, got %v", err)
+		}
+	}
+	if w.BreakerState() != BreakerOpen {
+		t.Fatalf("expected the breaker to open, got %v", w.BreakerState())
+	}
+
+	d.dials.Store(0)
+	if err := w.Err("three"); err != nil {
+		t.Fatalf("failed to write to the fallback: %v", err)
+	}
+	if n := d.dials.Load(); n != 0 {
+		t.Errorf("an open breaker should not dial, got %d attempts", n)
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if !strings.Contains(fallback.String(), fmt.Sprintf("tag[%d]: %s\n", os.Getpid(), msg)) {
+			t.Errorf("expected %q in the fallback, got %q", msg, fallback.String())
+		}
+	}
+
+	s = startTestStreamServer(t, s.addr)
+	defer s.kill()
+	d.down.Store(false)
+	time.Sleep(150 * time.Millisecond)
+	if err := w.Err("four"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	s.receive(t, "four")
+	if w.BreakerState() != BreakerClosed {
+		t.Errorf("expected the breaker to close, got %v", w.BreakerState())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := "closed->open,open->half-open,half-open->closed"
+	if got := strings.Join(transitions, ","); got != expected {
+		t.Errorf("expected transitions %s, got %s", expected, got)
+	}
+}
+
+func TestCircuitBreakerReopens(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR, "tag",
+		WithCustomDialContext(d.dial),
+		WithCircuitBreaker(1, 50*time.Millisecond, nil))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	if err := w.Err("fails"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if err := w.Err("rejected"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	time.Sleep(70 * time.Millisecond)
+	d.dials.Store(0)
+	if err := w.Err("probe"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to fail, got %v", err)
+	}
+	if n := d.dials.Load(); n == 0 {
+		t.Errorf("the half-open breaker should have dialed")
+	}
+	if w.BreakerState() != BreakerOpen {
+		t.Errorf("a failed probe should reopen the breaker, got %v", w.BreakerState())
+	}
+}
+
+func TestCircuitBreakerWriterFallback(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+	backup := startTestStreamServer(t, "127.0.0.1:0")
+	defer backup.kill()
+
+	fw, err := Dial("tcp", backup.addr, LOG_INFO|LOG_LOCAL0, "backup")
+	if err != nil {
+		t.Fatalf("failed to dial the fallback: %v", err)
+	}
+	defer fw.Close()
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR|LOG_LOCAL1, "tag",
+		WithCustomDialContext(d.dial),
+		WithCircuitBreaker(1, time.Minute, fw))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	if err := w.Warning("diverted"); err != nil {
+		t.Fatalf("failed to write to the fallback: %v", err)
+	}
+	// the message keeps its priority
+	backup.receive(t, fmt.Sprintf("<%d>", LOG_WARNING|LOG_LOCAL1))
+}
+
+func TestCircuitBreakerWithSpool(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	addr := s.addr
+	s.kill()
+
+	dir := t.TempDir()
+	var fallback bytes.Buffer
+	w, err := DialWithOptions("tcp", addr, LOG_ERR, "tag",
+		WithCircuitBreaker(1, time.Minute, &fallback),
+		WithSpool(SpoolConfig{Dir: dir, SegmentSize: 1, RetryInterval: time.Minute}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	for _, msg := range []string{"one", "two"} {
+		if err := w.Err(msg); err != nil {
+			t.Fatalf("failed writes should be spooled, got %v", err)
+		}
+	}
+	if st := w.SpoolStats(); st.Messages != 2 {
+		t.Errorf("expected both messages in the spool, got %+v", st)
+	}
+	if fallback.Len() != 0 {
+		t.Errorf("spooled messages should not reach the fallback, got %q", fallback.String())
+	}
+
+	// messages that cannot be spooled go to the fallback
+	os.RemoveAll(dir)
+	if err := w.Err("three"); err != nil {
+		t.Fatalf("failed to write to the fallback: %v", err)
+	}
+	if !strings.Contains(fallback.String(), fmt.Sprintf("tag[%d]: three\n", os.Getpid())) {
+		t.Errorf("expected the message in the fallback, got %q", fallback.String())
+	}
+}
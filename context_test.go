@@ -0,0 +1,154 @@
+package srslog
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDialContextCancelled(t *testing.T) {
+	l := startSilentServer(t, "tcp", "127.0.0.1:0")
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := DialContext(ctx, "relp", l.Addr().String(), LOG_ERR, "tag")
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("cancellation did not stop the handshake")
+	}
+}
+
+func TestDialContextTLSHandshake(t *testing.T) {
+	l := startSilentServer(t, "tcp", "127.0.0.1:0")
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DialContext(ctx, "tcp+tls", l.Addr().String(), LOG_ERR, "tag"); err == nil {
+		t.Errorf("should fail when the context expires during the handshake")
+	}
+}
+
+func TestWriteContextDeadline(t *testing.T) {
+	f, err := ioutil.TempFile("", "srslog-context")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	path := f.Name()
+	f.Close()
+	os.Remove(path)
+	defer os.Remove(path)
+
+	l := startSilentServer(t, "unix", path)
+	defer l.Close()
+
+	w, err := Dial("unix", path, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	// Large enough to fill the socket buffers of a server that never reads.
+	// It is built before the context starts, so that the write, which
+	// blocks until the context ends, has begun by then even when slow.
+	payload := []byte(strings.Repeat("x", 8<<20))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = w.WriteContext(ctx, payload)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if w.getConn() != nil {
+		t.Errorf("should drop a connection with an interrupted write")
+	}
+
+	if _, err := w.WriteContext(ctx, []byte("late")); err != context.DeadlineExceeded {
+		t.Errorf("should not write with an expired context, got %v", err)
+	}
+}
+
+func TestWriteWithPriorityContext(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("udp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	w, err := DialContext(context.Background(), "udp", addr, LOG_ERR, "syslog_test")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.WriteWithPriorityContext(context.Background(), LOG_USER|LOG_INFO, []byte("with context")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	check(t, "with context", <-done)
+}
+
+type contextKey struct{}
+
+func TestWithCustomDialContext(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("udp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	var got interface{}
+	dial := func(ctx context.Context, network, raddr string) (net.Conn, error) {
+		got = ctx.Value(contextKey{})
+		var d net.Dialer
+		return d.DialContext(ctx, "udp", raddr)
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+	w, err := DialContext(ctx, "custom", addr, LOG_ERR, "tag", WithCustomDialContext(dial))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	if got != "value" {
+		t.Errorf("the custom dialer should receive the dial context, got %v", got)
+	}
+	w.Err("custom")
+	<-done
+
+	if _, err := DialContext(ctx, "custom", addr, LOG_ERR, "tag", WithCustomDialContext(nil)); err != ErrNilDialFunc {
+		t.Errorf("expected ErrNilDialFunc, got %v", err)
+	}
+}
+
+func TestRELPWriteContextWindow(t *testing.T) {
+	s := startRELPServer(t)
+	defer s.l.Close()
+	s.setHoldAcks(true)
+
+	w, err := Dial("relp", s.l.Addr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	w.SetRELPWindow(1)
+	w.Err("one")
+	s.expect(t, "one")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := w.WriteContext(ctx, []byte("two")); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded while the window is full, got %v", err)
+	}
+
+	s.setHoldAcks(false)
+	s.release()
+	w.Close()
+}
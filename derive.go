@@ -0,0 +1,143 @@
+package srslog
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// SDElement is an RFC 5424 STRUCTURED-DATA element, such as
+// [tenant@32473 id="42"]. ID and the names of Params must be valid
+// SD-NAMEs: printable ASCII without '=', ' ', ']' or '"'. Params are sent
+// sorted by name.
+type SDElement struct {
+	ID     string
+	Params map[string]string
+}
+
+// WithTag returns a Writer that tags its messages with tag and otherwise
+// writes through w, sharing its connection, reconnects, queue, filters and
+// stats. It is cheap, so a subsystem can have its own tag without opening
+// another connection. Settings such as SetLevel and SetHostname change the
+// shared Writer, and closing a derived Writer does nothing; close the
+// Writer it was derived from instead.
+func (w *Writer) WithTag(tag string) *Writer {
+	d := w.derive()
+	d.tag = tag
+	return d
+}
+
+// WithFacility returns a Writer that sends Write and the severity methods,
+// such as Info, with facility, and otherwise writes through w, see WithTag.
+// WriteWithPriority, WriteMessage and WriteBatch keep the priority they are
+// given.
+func (w *Writer) WithFacility(facility Priority) *Writer {
+	d := w.derive()
+	d.priority = (facility & facilityMask) | (w.priority & severityMask)
+	return d
+}
+
+// WithStructuredData returns a Writer that adds elems to the STRUCTURED-DATA
+// of its messages, and otherwise writes through w, see WithTag. An element
+// of a message replaces the element with the same ID from its Writer. The
+// elements are sent by RFC5424Formatter, RFC5424MessageFormatter and the
+// "journald" network. Other formats, including Formatters of other
+// packages, drop them rather than fail the write.
+func (w *Writer) WithStructuredData(elems ...SDElement) *Writer {
+	d := w.derive()
+	d.structuredData = mergeStructuredData(w.structuredData, elems)
+	return d
+}
+
+// derive returns a Writer with the defaults of w that writes through the
+// Writer w was derived from, if any, so that chains of derived Writers stay
+// one level deep.
+func (w *Writer) derive() *Writer {
+	return &Writer{
+		parent:         w.root(),
+		priority:       w.priority,
+		tag:            w.tag,
+		structuredData: w.structuredData,
+	}
+}
+
+// root returns the Writer that owns the connection and state of w.
+func (w *Writer) root() *Writer {
+	if w.parent != nil {
+		return w.parent
+	}
+	return w
+}
+
+// stamp fills in the defaults of a derived Writer that a message does not
+// override.
+func (w *Writer) stamp(m Message) Message {
+	if m.Tag == "" {
+		m.Tag = w.tag
+	}
+	if len(m.StructuredData) == 0 && len(w.structuredData) > 0 {
+		m.inherited = true
+	}
+	m.StructuredData = mergeStructuredData(w.structuredData, m.StructuredData)
+	return m
+}
+
+// writeDerived writes a message of a derived Writer through its root.
+func (w *Writer) writeDerived(ctx context.Context, m Message) (int, error) {
+	return w.parent.writeMessage(ctx, w.stamp(m))
+}
+
+// mergeStructuredData returns the elements of base whose ID is not in
+// override, followed by override.
+func mergeStructuredData(base, override []SDElement) []SDElement {
+	if len(base) == 0 {
+		return override
+	}
+	if len(override) == 0 {
+		return base
+	}
+	merged := make([]SDElement, 0, len(base)+len(override))
+	for _, e := range base {
+		if !hasSDElement(override, e.ID) {
+			merged = append(merged, e)
+		}
+	}
+	return append(merged, override...)
+}
+
+func hasSDElement(elems []SDElement, id string) bool {
+	for _, e := range elems {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sdValueEscaper escapes the characters RFC 5424 requires escaping in
+// PARAM-VALUEs.
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// formatStructuredData returns the STRUCTURED-DATA of elems, or "" if there
+// are none.
+func formatStructuredData(elems []SDElement) string {
+	var b strings.Builder
+	for _, e := range elems {
+		b.WriteString("[")
+		b.WriteString(e.ID)
+		names := make([]string, 0, len(e.Params))
+		for name := range e.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString(" ")
+			b.WriteString(name)
+			b.WriteString(`="`)
+			sdValueEscaper.WriteString(&b, e.Params[name])
+			b.WriteString(`"`)
+		}
+		b.WriteString("]")
+	}
+	return b.String()
+}
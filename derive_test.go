@@ -0,0 +1,176 @@
+package srslog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDerivedWriters(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR|LOG_DAEMON, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetHostname("host")
+
+	billing := w.WithTag("billing")
+	local3 := billing.WithFacility(LOG_LOCAL3)
+	billing.Info("invoice sent")
+	local3.Write([]byte("ledger closed"))
+	if err := billing.Close(); err != nil {
+		t.Errorf("closing a derived Writer failed: %v", err)
+	}
+	w.Err("parent")
+
+	pid := os.Getpid()
+	for _, want := range []struct {
+		p       Priority
+		content string
+	}{
+		{LOG_DAEMON | LOG_INFO, fmt.Sprintf("host billing[%d]: invoice sent\n", pid)},
+		{LOG_LOCAL3 | LOG_ERR, fmt.Sprintf("host billing[%d]: ledger closed\n", pid)},
+		{LOG_DAEMON | LOG_ERR, fmt.Sprintf("host tag[%d]: parent\n", pid)},
+	} {
+		select {
+		case m := <-s.msgs:
+			if !strings.HasPrefix(m, fmt.Sprintf("<%d>", want.p)) || !strings.HasSuffix(m, want.content) {
+				t.Errorf("expected <%d> and %q, got %q", want.p, want.content, m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want.content)
+		}
+	}
+
+	s.mu.Lock()
+	conns := len(s.conns)
+	s.mu.Unlock()
+	if conns != 1 {
+		t.Errorf("expected derived Writers to share one connection, got %d", conns)
+	}
+}
+
+func TestDerivedWriterTags(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetHostname("host")
+
+	d := w.WithTag("billing").WithFacility(LOG_LOCAL3)
+	d.Err("one")
+	d.WriteBatch([]Message{{Priority: LOG_ERR, Content: "two"}})
+	d.WriteMessage(&Message{Priority: LOG_ERR, Content: "three", Tag: "own"})
+
+	pid := os.Getpid()
+	s.receiveNext(t, fmt.Sprintf("host billing[%d]: one", pid))
+	s.receiveNext(t, fmt.Sprintf("host billing[%d]: two", pid))
+	s.receiveNext(t, fmt.Sprintf("host own[%d]: three", pid))
+}
+
+func TestDerivedWriterSharesSettings(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithAsync(10, OverflowBlock))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d := w.WithTag("billing")
+	d.SetLevel(LOG_WARNING)
+	if w.Level() != LOG_WARNING {
+		t.Errorf("expected the level to be shared, got %v", w.Level())
+	}
+	d.Info("dropped")
+	d.Err("kept")
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	s.receiveNext(t, "kept")
+	if d.Dropped() != w.Dropped() {
+		t.Errorf("expected stats to be shared")
+	}
+}
+
+func TestDerivedWriterStructuredData(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetMessageFormatter(RFC5424MessageFormatter)
+
+	d := w.WithStructuredData(
+		SDElement{ID: "tenant@32473", Params: map[string]string{"id": "42", "name": `a "quoted] \name`}},
+		SDElement{ID: "origin@32473"},
+	)
+	d.Err("one")
+	d.WriteMessage(&Message{
+		Priority:       LOG_ERR,
+		Content:        "two",
+		StructuredData: []SDElement{{ID: "tenant@32473", Params: map[string]string{"id": "7"}}},
+	})
+	w.Err("three")
+
+	for _, want := range []string{
+		` tag [tenant@32473 id="42" name="a \"quoted\] \\name"][origin@32473] one` + "\n",
+		` tag [origin@32473][tenant@32473 id="7"] two` + "\n",
+		` tag - three` + "\n",
+	} {
+		select {
+		case m := <-s.msgs:
+			if !strings.HasSuffix(m, want) {
+				t.Errorf("expected %q, got %q", want, m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
+
+func TestDerivedWriterStructuredDataFormatters(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	d := w.WithStructuredData(SDElement{ID: "tenant@32473", Params: map[string]string{"id": "42"}})
+
+	w.SetFormatter(RFC5424Formatter)
+	if err := d.Err("rfc5424"); err != nil {
+		t.Errorf("failed to write with RFC5424Formatter: %v", err)
+	}
+	s.receiveNext(t, `[tenant@32473 id="42"] rfc5424`)
+
+	// formats without structured data drop it, rather than the message
+	w.SetFormatter(func(p Priority, hostname, tag, content string) string {
+		return tag + " " + content
+	})
+	if err := d.Err("custom"); err != nil {
+		t.Errorf("failed to write with a custom Formatter: %v", err)
+	}
+	s.receiveNext(t, "tag custom")
+
+	err = d.WriteMessage(&Message{Priority: LOG_ERR, Content: "own", StructuredData: []SDElement{{ID: "a@1"}}})
+	if err != ErrOverrideUnsupported {
+		t.Errorf("expected ErrOverrideUnsupported for the message's own structured data, got %v", err)
+	}
+}
@@ -1,7 +1,7 @@
 package srslog
 
 import (
-	"crypto/tls"
+	"context"
 	"net"
 )
 
@@ -12,12 +12,12 @@ import (
 // be useful for you without having to use reflection.
 type dialerFunctionWrapper struct {
 	Name   string
-	Dialer func() (serverConn, string, error)
+	Dialer func(ctx context.Context) (serverConn, string, error)
 }
 
 // Call the wrapped dialer function and return its return values.
-func (df dialerFunctionWrapper) Call() (serverConn, string, error) {
-	return df.Dialer()
+func (df dialerFunctionWrapper) Call(ctx context.Context) (serverConn, string, error) {
+	return df.Dialer(ctx)
 }
 
 // getDialer returns a "dialer" function that can be called to connect to a
@@ -25,7 +25,8 @@ func (df dialerFunctionWrapper) Call() (serverConn, string, error) {
 //
 // Each dialer function is responsible for dialing the remote host and returns
 // a serverConn, the hostname (or a default if the Writer has not specified a
-// hostname), and an error in case dialing fails.
+// hostname), and an error in case dialing fails. Dialing is abandoned when
+// the context passed to the dialer is done.
 //
 // The reason for separate dialers is that different network types may need
 // to dial their connection differently, yet still provide a net.Conn interface
@@ -35,9 +36,17 @@ func (df dialerFunctionWrapper) Call() (serverConn, string, error) {
 // function and adding it to the map.
 func (w *Writer) getDialer() dialerFunctionWrapper {
 	dialers := map[string]dialerFunctionWrapper{
-		"":        dialerFunctionWrapper{"unixDialer", w.unixDialer},
-		"tcp+tls": dialerFunctionWrapper{"tlsDialer", w.tlsDialer},
-		"custom":  dialerFunctionWrapper{"customDialer", w.customDialer},
+		"":         dialerFunctionWrapper{"unixDialer", w.unixDialer},
+		"unix":     dialerFunctionWrapper{"localDialer", w.localDialer},
+		"unixgram": dialerFunctionWrapper{"localDialer", w.localDialer},
+		"tcp+tls":  dialerFunctionWrapper{"tlsDialer", w.tlsDialer},
+		"custom":   dialerFunctionWrapper{"customDialer", w.customDialer},
+		"relp":     dialerFunctionWrapper{"relpDialer", w.relpDialer},
+		"journald": dialerFunctionWrapper{"journalDialer", w.journalDialer},
+		"failover": dialerFunctionWrapper{"failoverDialer", w.failoverDialer},
+		"pool":     dialerFunctionWrapper{"poolDialer", w.poolDialer},
+		"srv":      dialerFunctionWrapper{"srvDialer", w.srvDialer},
+		"srv+tls":  dialerFunctionWrapper{"srvDialer", w.srvDialer},
 	}
 	dialer, ok := dialers[w.network]
 	if !ok {
@@ -48,9 +57,27 @@ func (w *Writer) getDialer() dialerFunctionWrapper {
 
 // unixDialer uses the unixSyslog method to open a connection to the syslog
 // daemon running on the local machine.
-func (w *Writer) unixDialer() (serverConn, string, error) {
-	sc, err := unixSyslog()
-	hostname := w.hostname
+func (w *Writer) unixDialer(ctx context.Context) (serverConn, string, error) {
+	sc, err := unixSyslog(ctx, w.localPaths, w.localFormat, w.netDialer(), w.writeTimeout)
+	hostname := w.getHostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return sc, hostname, err
+}
+
+// localDialer connects to the local socket at raddr, and is used for the
+// "unix" and "unixgram" network types. Unlike basicDialer it gives the
+// connection local semantics: the Writer's LocalFormat by default, newline
+// delimited messages on stream sockets and "localhost" rather than the
+// socket address as the default hostname.
+func (w *Writer) localDialer(ctx context.Context) (serverConn, string, error) {
+	var sc serverConn
+	c, err := dialLocal(ctx, w.netDialer(), w.network, w.raddr, w.localFormat, w.writeTimeout)
+	if err == nil {
+		sc = c
+	}
+	hostname := w.getHostname()
 	if hostname == "" {
 		hostname = "localhost"
 	}
@@ -59,12 +86,12 @@ func (w *Writer) unixDialer() (serverConn, string, error) {
 
 // tlsDialer connects to TLS over TCP, and is used for the "tcp+tls" network
 // type.
-func (w *Writer) tlsDialer() (serverConn, string, error) {
-	c, err := tls.Dial("tcp", w.raddr, w.tlsConfig)
+func (w *Writer) tlsDialer(ctx context.Context) (serverConn, string, error) {
+	c, err := w.dialTLS(ctx, w.raddr)
 	var sc serverConn
-	hostname := w.hostname
+	hostname := w.getHostname()
 	if err == nil {
-		sc = &netConn{conn: c}
+		sc = newNetConn(c, w.writeTimeout)
 		if hostname == "" {
 			hostname = c.LocalAddr().String()
 		}
@@ -74,12 +101,12 @@ func (w *Writer) tlsDialer() (serverConn, string, error) {
 
 // basicDialer is the most common dialer for syslog, and supports both TCP and
 // UDP connections.
-func (w *Writer) basicDialer() (serverConn, string, error) {
-	c, err := net.Dial(w.network, w.raddr)
+func (w *Writer) basicDialer(ctx context.Context) (serverConn, string, error) {
+	c, err := w.dialNet(ctx, w.network, w.raddr)
 	var sc serverConn
-	hostname := w.hostname
+	hostname := w.getHostname()
 	if err == nil {
-		sc = &netConn{conn: c}
+		sc = newNetConn(c, w.writeTimeout)
 		if hostname == "" {
 			hostname = c.LocalAddr().String()
 		}
@@ -90,15 +117,90 @@ func (w *Writer) basicDialer() (serverConn, string, error) {
 // customDialer uses the custom dialer when the Writer was created
 // giving developers total control over how connections are made and returned.
 // Note it does not check if cdialer is nil, as it should only be referenced from getDialer.
-func (w *Writer) customDialer() (serverConn, string, error) {
-	c, err := w.customDial(w.network, w.raddr)
+// A DialContextFunc set with WithCustomDialContext takes precedence and
+// receives the context, bounded by the dial timeout. A DialFunc cannot be
+// interrupted, so only the write timeout applies to it.
+func (w *Writer) customDialer(ctx context.Context) (serverConn, string, error) {
+	var c net.Conn
+	var err error
+	if w.customDialContext != nil {
+		if w.dialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, w.dialTimeout)
+			defer cancel()
+		}
+		c, err = w.customDialContext(ctx, w.network, w.raddr)
+	} else {
+		c, err = w.customDial(w.network, w.raddr)
+	}
 	var sc serverConn
-	hostname := w.hostname
+	hostname := w.getHostname()
 	if err == nil {
-		sc = &netConn{conn: c}
+		sc = newNetConn(c, w.writeTimeout)
 		if hostname == "" {
 			hostname = c.LocalAddr().String()
 		}
 	}
 	return sc, hostname, err
 }
+
+// relpDialer connects to a RELP server, over TLS if the Writer has a TLS
+// configuration, and is used for the "relp" network type.
+func (w *Writer) relpDialer(ctx context.Context) (serverConn, string, error) {
+	var c net.Conn
+	var err error
+	if w.tlsConfig != nil {
+		c, err = w.dialTLS(ctx, w.raddr)
+	} else {
+		c, err = w.dialNet(ctx, "tcp", w.raddr)
+	}
+	if err != nil {
+		return nil, w.getHostname(), err
+	}
+
+	w.mu.Lock()
+	if w.relp == nil {
+		w.relp = &relpSession{}
+	}
+	session := w.relp
+	window := w.relpWindow
+	w.mu.Unlock()
+
+	openTimeout := relpAckTimeout
+	if w.dialTimeout > 0 {
+		openTimeout = w.dialTimeout
+	}
+	rc, err := newRELPConn(ctx, c, session, window, w.writeTimeout, openTimeout)
+	if err != nil {
+		return nil, w.getHostname(), err
+	}
+	hostname := w.getHostname()
+	if hostname == "" {
+		hostname = c.LocalAddr().String()
+	}
+	return rc, hostname, nil
+}
+
+// journalDialer connects to systemd-journald's native protocol socket,
+// raddr if it is set or DefaultJournalSocket otherwise, and is used for
+// the "journald" network type.
+func (w *Writer) journalDialer(ctx context.Context) (serverConn, string, error) {
+	path := w.raddr
+	if path == "" {
+		path = DefaultJournalSocket
+	}
+	hostname := w.getHostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+
+	c, err := w.netDialer().DialContext(ctx, "unixgram", path)
+	if err != nil {
+		return nil, hostname, err
+	}
+
+	w.mu.RLock()
+	fields := w.journalFields
+	w.mu.RUnlock()
+	return &journalConn{conn: c.(*net.UnixConn), fields: fields, writeTimeout: w.writeTimeout}, hostname, nil
+}
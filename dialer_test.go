@@ -1,6 +1,7 @@
 package srslog
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -47,6 +48,50 @@ func TestGetDialer(t *testing.T) {
 		t.Errorf("should get basicDialer, got: %v", dialer)
 	}
 
+	w.network = "unix"
+	dialer = w.getDialer()
+	if "localDialer" != dialer.Name {
+		t.Errorf("should get localDialer, got: %v", dialer)
+	}
+
+	w.network = "unixgram"
+	dialer = w.getDialer()
+	if "localDialer" != dialer.Name {
+		t.Errorf("should get localDialer, got: %v", dialer)
+	}
+
+	w.network = "relp"
+	dialer = w.getDialer()
+	if "relpDialer" != dialer.Name {
+		t.Errorf("should get relpDialer, got: %v", dialer)
+	}
+
+	w.network = "journald"
+	dialer = w.getDialer()
+	if "journalDialer" != dialer.Name {
+		t.Errorf("should get journalDialer, got: %v", dialer)
+	}
+
+	w.network = "failover"
+	dialer = w.getDialer()
+	if "failoverDialer" != dialer.Name {
+		t.Errorf("should get failoverDialer, got: %v", dialer)
+	}
+
+	w.network = "pool"
+	dialer = w.getDialer()
+	if "poolDialer" != dialer.Name {
+		t.Errorf("should get poolDialer, got: %v", dialer)
+	}
+
+	for _, network := range []string{"srv", "srv+tls"} {
+		w.network = network
+		dialer = w.getDialer()
+		if "srvDialer" != dialer.Name {
+			t.Errorf("should get srvDialer for %q, got: %v", network, dialer)
+		}
+	}
+
 	w.network = "custom"
 	w.customDial = func(string, string) (net.Conn, error) { return nil, nil }
 	dialer = w.getDialer()
@@ -64,7 +109,7 @@ func TestUnixDialer(t *testing.T) {
 		raddr:    "",
 	}
 
-	_, hostname, err := w.unixDialer()
+	_, hostname, err := w.unixDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -76,7 +121,7 @@ func TestUnixDialer(t *testing.T) {
 
 	w.hostname = "my other hostname"
 
-	_, hostname, err = w.unixDialer()
+	_, hostname, err = w.unixDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -111,7 +156,7 @@ func TestTLSDialer(t *testing.T) {
 		tlsConfig: &config,
 	}
 
-	_, hostname, err := w.tlsDialer()
+	_, hostname, err := w.tlsDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -123,7 +168,7 @@ func TestTLSDialer(t *testing.T) {
 
 	w.hostname = "my other hostname"
 
-	_, hostname, err = w.tlsDialer()
+	_, hostname, err = w.tlsDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -147,7 +192,7 @@ func TestTCPDialer(t *testing.T) {
 		raddr:    addr,
 	}
 
-	_, hostname, err := w.basicDialer()
+	_, hostname, err := w.basicDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -159,7 +204,7 @@ func TestTCPDialer(t *testing.T) {
 
 	w.hostname = "my other hostname"
 
-	_, hostname, err = w.basicDialer()
+	_, hostname, err = w.basicDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -183,7 +228,7 @@ func TestUDPDialer(t *testing.T) {
 		raddr:    addr,
 	}
 
-	_, hostname, err := w.basicDialer()
+	_, hostname, err := w.basicDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -195,7 +240,7 @@ func TestUDPDialer(t *testing.T) {
 
 	w.hostname = "my other hostname"
 
-	_, hostname, err = w.basicDialer()
+	_, hostname, err = w.basicDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -226,7 +271,7 @@ func TestCustomDialer(t *testing.T) {
 		},
 	}
 
-	_, hostname, err := w.customDialer()
+	_, hostname, err := w.customDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
@@ -238,7 +283,7 @@ func TestCustomDialer(t *testing.T) {
 
 	w.hostname = "my other hostname"
 
-	_, hostname, err = w.customDialer()
+	_, hostname, err = w.customDialer(context.Background())
 
 	if err != nil {
 		t.Errorf("failed to dial: %v", err)
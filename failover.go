@@ -0,0 +1,245 @@
+package srslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFailbackInterval is how often a failover Writer probes the
+// endpoints ahead of the active one, see WithFailbackInterval.
+const DefaultFailbackInterval = 30 * time.Second
+
+// ErrNoEndpoints is returned when a Writer is dialed with an empty list of
+// endpoints.
+var ErrNoEndpoints = errors.New("srslog: no endpoints")
+
+// An Endpoint is one syslog destination of a Writer created with
+// DialFailover. Each endpoint may use a different network and TLS
+// configuration; all other settings come from the Writer's options.
+type Endpoint struct {
+	Network   string
+	Addr      string
+	TLSConfig *tls.Config
+}
+
+func (e Endpoint) String() string {
+	return e.Network + "://" + e.Addr
+}
+
+// FailoverError is returned when no endpoint of a failover or pool Writer
+// could be connected or written to. It holds the error of each endpoint
+// that was tried, in order.
+type FailoverError struct {
+	Errors []error
+}
+
+func (e *FailoverError) Error() string {
+	reasons := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		reasons[i] = err.Error()
+	}
+	return "srslog: all endpoints failed: " + strings.Join(reasons, "; ")
+}
+
+// failoverGroup is the state of a Writer created with DialFailover. Each
+// endpoint has an unconnected member Writer that is only used for its
+// dialer, so every network type works as an endpoint.
+type failoverGroup struct {
+	endpoints []Endpoint
+	members   []*Writer
+	interval  time.Duration
+
+	mu     sync.Mutex // guards active
+	active int        // index of the endpoint in use, -1 if none
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// WithFailbackInterval sets how often a Writer created with DialFailover
+// tries to reconnect to the endpoints ahead of the active one. It defaults
+// to DefaultFailbackInterval.
+func WithFailbackInterval(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.failbackInterval = d
+		return nil
+	}
+}
+
+// DialFailover establishes a connection to the first of endpoints that
+// can be reached. When a write to the active endpoint fails, the Writer
+// reconnects to the first endpoint that accepts a connection, starting
+// again from the primary. While an endpoint other than the primary is
+// active, the endpoints ahead of it are probed in the background and the
+// Writer fails back as soon as one of them recovers.
+func DialFailover(endpoints []Endpoint, priority Priority, tag string, opts ...Option) (*Writer, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	opts = append(opts, func(w *Writer) error {
+		g := &failoverGroup{
+			endpoints: append([]Endpoint(nil), endpoints...),
+			interval:  w.failbackInterval,
+			active:    -1,
+			stop:      make(chan struct{}),
+		}
+		if g.interval <= 0 {
+			g.interval = DefaultFailbackInterval
+		}
+		for _, e := range endpoints {
+			g.members = append(g.members, w.memberWriter(e))
+		}
+		w.failover = g
+		return nil
+	})
+
+	w, err := dialAllParameters(context.Background(), "failover", "", priority, tag, nil, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go w.probeFailback()
+	return w, nil
+}
+
+// memberWriter returns an unconnected Writer for endpoint e that shares
+// w's settings, for use as a member of a group of endpoints.
+func (w *Writer) memberWriter(e Endpoint) *Writer {
+	return &Writer{
+		priority:            w.priority,
+		tag:                 w.tag,
+		network:             e.Network,
+		raddr:               e.Addr,
+		tlsConfig:           e.TLSConfig,
+		customDial:          w.customDial,
+		customDialContext:   w.customDialContext,
+		relpWindow:          w.relpWindow,
+		journalFields:       w.journalFields,
+		localPaths:          w.localPaths,
+		localFormat:         w.localFormat,
+		dialTimeout:         w.dialTimeout,
+		tlsHandshakeTimeout: w.tlsHandshakeTimeout,
+		writeTimeout:        w.writeTimeout,
+		proxy:               w.proxy,
+		noProxy:             w.noProxy,
+		keepAlive:           w.keepAlive,
+		tcpUserTimeout:      w.tcpUserTimeout,
+	}
+}
+
+// ActiveEndpoint returns the endpoint messages are currently sent to. It
+// returns false if the Writer was not created with DialFailover or is not
+// connected.
+func (w *Writer) ActiveEndpoint() (Endpoint, bool) {
+	w = w.root()
+	g := w.failover
+	if g == nil {
+		return Endpoint{}, false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active < 0 {
+		return Endpoint{}, false
+	}
+	return g.endpoints[g.active], true
+}
+
+// failoverDialer connects to the first endpoint that accepts a connection,
+// and is used for Writers created with DialFailover.
+func (w *Writer) failoverDialer(ctx context.Context) (serverConn, string, error) {
+	g := w.failover
+	if g == nil {
+		return nil, w.getHostname(), ErrNoEndpoints
+	}
+
+	failed := &FailoverError{}
+	for i := range g.members {
+		sc, hostname, err := w.dialMember(ctx, g.members[i])
+		if err == nil {
+			g.setActive(i)
+			return sc, hostname, nil
+		}
+		failed.Errors = append(failed.Errors, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	g.setActive(-1)
+	return nil, w.getHostname(), failed
+}
+
+// dialMember connects to a member's endpoint. The Writer's own hostname,
+// if set, takes precedence over the member's default.
+func (w *Writer) dialMember(ctx context.Context, m *Writer) (serverConn, string, error) {
+	sc, hostname, err := m.getDialer().Call(ctx)
+	if h := w.getHostname(); h != "" {
+		hostname = h
+	}
+	return sc, hostname, err
+}
+
+func (g *failoverGroup) setActive(i int) {
+	g.mu.Lock()
+	g.active = i
+	g.mu.Unlock()
+}
+
+func (g *failoverGroup) getActive() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active
+}
+
+// close stops the background probe.
+func (g *failoverGroup) close() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// probeFailback periodically tries the endpoints ahead of the active one
+// and switches the Writer over to the first that accepts a connection.
+func (w *Writer) probeFailback() {
+	g := w.failover
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+
+		active := g.getActive()
+		current := w.getConn()
+		if active <= 0 || current == nil {
+			continue
+		}
+
+		for i := 0; i < active; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), g.interval)
+			sc, _, err := w.dialMember(ctx, g.members[i])
+			cancel()
+			if err != nil {
+				continue
+			}
+
+			// Only switch if no write reconnected in the meantime.
+			w.mu.Lock()
+			swapped := w.conn == current
+			if swapped {
+				w.conn = sc
+			}
+			w.mu.Unlock()
+			if swapped {
+				g.setActive(i)
+				current.close()
+			} else {
+				sc.close()
+			}
+			break
+		}
+	}
+}
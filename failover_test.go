@@ -0,0 +1,184 @@
+package srslog
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStreamServer is a TCP syslog server whose connections can be killed,
+// to simulate a collector going down.
+type testStreamServer struct {
+	l    net.Listener
+	addr string
+	msgs chan string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startTestStreamServer(t *testing.T, addr string) *testStreamServer {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &testStreamServer{l: l, addr: l.Addr().String(), msgs: make(chan string, 100)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.mu.Unlock()
+			go func(c net.Conn) {
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					s.msgs <- line
+				}
+			}(c)
+		}
+	}()
+	return s
+}
+
+// kill closes the listener and every connection.
+func (s *testStreamServer) kill() {
+	s.l.Close()
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+	s.mu.Unlock()
+}
+
+// receive waits for a message containing content.
+func (s *testStreamServer) receive(t *testing.T, content string) {
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case m := <-s.msgs:
+			if strings.Contains(m, content) {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("%s: timed out waiting for %q", s.addr, content)
+		}
+	}
+}
+
+// unusedAddr returns a local address nothing listens on.
+func unusedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestFailoverAndFailback(t *testing.T) {
+	primaryAddr := unusedAddr(t)
+	secondary := startTestStreamServer(t, "127.0.0.1:0")
+	defer secondary.kill()
+
+	endpoints := []Endpoint{{Network: "tcp", Addr: primaryAddr}, {Network: "tcp", Addr: secondary.addr}}
+	w, err := DialFailover(endpoints, LOG_ERR, "tag", WithFailbackInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	if e, ok := w.ActiveEndpoint(); !ok || e != endpoints[1] {
+		t.Errorf("expected the secondary to be active, got %v", e)
+	}
+	w.Err("to secondary")
+	secondary.receive(t, "to secondary")
+
+	primary := startTestStreamServer(t, primaryAddr)
+	defer primary.kill()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if e, _ := w.ActiveEndpoint(); e == endpoints[0] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("did not fail back to the primary")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Err("to primary")
+	primary.receive(t, "to primary")
+}
+
+func TestFailoverOnWriteError(t *testing.T) {
+	primary := startTestStreamServer(t, "127.0.0.1:0")
+	secondary := startTestStreamServer(t, "127.0.0.1:0")
+	defer secondary.kill()
+
+	endpoints := []Endpoint{{Network: "tcp", Addr: primary.addr}, {Network: "tcp", Addr: secondary.addr}}
+	w, err := DialFailover(endpoints, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("to primary")
+	primary.receive(t, "to primary")
+	primary.kill()
+
+	// The first write after the primary goes away may still be accepted
+	// by the kernel, so keep writing until one fails over.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w.Err("after failover")
+		if e, _ := w.ActiveEndpoint(); e == endpoints[1] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("did not fail over to the secondary")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	secondary.receive(t, "after failover")
+}
+
+func TestFailoverAllEndpointsDown(t *testing.T) {
+	endpoints := []Endpoint{{Network: "tcp", Addr: unusedAddr(t)}, {Network: "tcp", Addr: unusedAddr(t)}}
+	_, err := DialFailover(endpoints, LOG_ERR, "tag")
+	failed, ok := err.(*FailoverError)
+	if !ok {
+		t.Fatalf("expected a *FailoverError, got %v", err)
+	}
+	if len(failed.Errors) != 2 {
+		t.Errorf("expected an error per endpoint, got %v", failed.Errors)
+	}
+
+	if _, err := DialFailover(nil, LOG_ERR, "tag"); err != ErrNoEndpoints {
+		t.Errorf("expected ErrNoEndpoints, got %v", err)
+	}
+}
+
+func TestActiveEndpointWithoutFailover(t *testing.T) {
+	w := Writer{}
+	if _, ok := w.ActiveEndpoint(); ok {
+		t.Errorf("should not report an endpoint for a plain Writer")
+	}
+}
+
+func TestEndpointString(t *testing.T) {
+	if s := (Endpoint{Network: "tcp", Addr: "127.0.0.1:514"}).String(); s != "tcp://127.0.0.1:514" {
+		t.Errorf("unexpected endpoint string %q", s)
+	}
+}
@@ -3,6 +3,7 @@ package srslog
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 )
 
@@ -13,29 +14,78 @@ const appNameMaxLength = 48 // limit to 48 chars as per RFC5424
 // defined for each different syslog protocol we support.
 type Formatter func(p Priority, hostname, tag, content string) string
 
+// MessageFormatter is a type of function that formats a whole Message.
+// Unlike a Formatter, it is given the message's Timestamp and
+// StructuredData, so it can honour the overrides of WriteMessage. Hostname
+// and Tag are already filled in; a zero Timestamp means the current time.
+// Each Formatter of this package has a MessageFormatter counterpart.
+type MessageFormatter func(m *Message) string
+
+// message adapts f to a MessageFormatter, which ignores the Timestamp and
+// StructuredData of messages.
+func (f Formatter) message() MessageFormatter {
+	return func(m *Message) string {
+		return f(m.Priority, m.Hostname, m.Tag, m.Content)
+	}
+}
+
+// messageFormatterOf returns the MessageFormatter counterpart of one of
+// the Formatters of this package, or nil for any other Formatter.
+func messageFormatterOf(f Formatter) MessageFormatter {
+	switch reflect.ValueOf(f).Pointer() {
+	case reflect.ValueOf(DefaultFormatter).Pointer():
+		return DefaultMessageFormatter
+	case reflect.ValueOf(UnixFormatter).Pointer():
+		return UnixMessageFormatter
+	case reflect.ValueOf(RFC3164Formatter).Pointer():
+		return RFC3164MessageFormatter
+	case reflect.ValueOf(RFC5424Formatter).Pointer():
+		return RFC5424MessageFormatter
+	}
+	return nil
+}
+
 // DefaultFormatter is the original format supported by the Go syslog package,
 // and is a non-compliant amalgamation of 3164 and 5424 that is intended to
 // maximize compatibility.
 func DefaultFormatter(p Priority, hostname, tag, content string) string {
-	timestamp := time.Now().Format(time.RFC3339)
+	return DefaultMessageFormatter(&Message{Priority: p, Hostname: hostname, Tag: tag, Content: content})
+}
+
+// DefaultMessageFormatter is DefaultFormatter as a MessageFormatter. The
+// format has no place for structured data.
+func DefaultMessageFormatter(m *Message) string {
+	timestamp := m.time().Format(time.RFC3339)
 	msg := fmt.Sprintf("<%d> %s %s %s[%d]: %s",
-		p, timestamp, hostname, tag, os.Getpid(), content)
+		m.Priority, timestamp, m.Hostname, m.Tag, os.Getpid(), m.Content)
 	return msg
 }
 
 // UnixFormatter omits the hostname, because it is only used locally.
 func UnixFormatter(p Priority, hostname, tag, content string) string {
-	timestamp := time.Now().Format(time.Stamp)
+	return UnixMessageFormatter(&Message{Priority: p, Hostname: hostname, Tag: tag, Content: content})
+}
+
+// UnixMessageFormatter is UnixFormatter as a MessageFormatter. The format
+// has no place for structured data.
+func UnixMessageFormatter(m *Message) string {
+	timestamp := m.time().Format(time.Stamp)
 	msg := fmt.Sprintf("<%d>%s %s[%d]: %s",
-		p, timestamp, tag, os.Getpid(), content)
+		m.Priority, timestamp, m.Tag, os.Getpid(), m.Content)
 	return msg
 }
 
 // RFC3164Formatter provides an RFC 3164 compliant message.
 func RFC3164Formatter(p Priority, hostname, tag, content string) string {
-	timestamp := time.Now().Format(time.Stamp)
+	return RFC3164MessageFormatter(&Message{Priority: p, Hostname: hostname, Tag: tag, Content: content})
+}
+
+// RFC3164MessageFormatter is RFC3164Formatter as a MessageFormatter. RFC
+// 3164 has no place for structured data.
+func RFC3164MessageFormatter(m *Message) string {
+	timestamp := m.time().Format(time.Stamp)
 	msg := fmt.Sprintf("<%d>%s %s %s[%d]: %s",
-		p, timestamp, hostname, tag, os.Getpid(), content)
+		m.Priority, timestamp, m.Hostname, m.Tag, os.Getpid(), m.Content)
 	return msg
 }
 
@@ -49,10 +99,20 @@ func truncateStartStr(s string, max int) string {
 
 // RFC5424Formatter provides an RFC 5424 compliant message.
 func RFC5424Formatter(p Priority, hostname, tag, content string) string {
-	timestamp := time.Now().Format(time.RFC3339)
+	return RFC5424MessageFormatter(&Message{Priority: p, Hostname: hostname, Tag: tag, Content: content})
+}
+
+// RFC5424MessageFormatter is RFC5424Formatter as a MessageFormatter, which
+// also sends the message's StructuredData.
+func RFC5424MessageFormatter(m *Message) string {
+	timestamp := m.time().Format(time.RFC3339)
 	pid := os.Getpid()
 	appName := truncateStartStr(os.Args[0], appNameMaxLength)
-	msg := fmt.Sprintf("<%d>%d %s %s %s %d %s - %s",
-		p, 1, timestamp, hostname, appName, pid, tag, content)
+	sd := formatStructuredData(m.StructuredData)
+	if sd == "" {
+		sd = "-"
+	}
+	msg := fmt.Sprintf("<%d>%d %s %s %s %d %s %s %s",
+		m.Priority, 1, timestamp, m.Hostname, appName, pid, m.Tag, sd, m.Content)
 	return msg
 }
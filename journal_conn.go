@@ -0,0 +1,189 @@
+package srslog
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJournalSocket is the socket systemd-journald listens on for its
+// native protocol. It is used by the "journald" network when no address
+// is given.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalConn adheres to the serverConn interface and sends messages to
+// systemd-journald using its native protocol, which keeps the priority,
+// tag, caller and custom fields as separate journal fields instead of
+// flattening them into a syslog line.
+type journalConn struct {
+	conn         *net.UnixConn
+	writeTimeout time.Duration
+
+	mu     sync.RWMutex // guards fields
+	fields map[string]string
+}
+
+// writeString sends one journal entry. Formatter and framer are not used,
+// and neither is the hostname, which journald records itself. Entries
+// too large for a datagram are passed to journald as a file descriptor.
+func (j *journalConn) writeString(ctx context.Context, framer Framer, formatter MessageFormatter, m *Message) error {
+	j.mu.RLock()
+	entry := journalEntry(m, j.fields)
+	j.mu.RUnlock()
+
+	defer setWriteDeadline(ctx, j.conn, j.writeTimeout)()
+	_, err := j.conn.Write(entry)
+	if err != nil && isMessageTooLong(err) {
+		err = sendJournalFD(j.conn, entry)
+	}
+	return err
+}
+
+// setFields replaces the custom fields added to every entry.
+func (j *journalConn) setFields(fields map[string]string) {
+	j.mu.Lock()
+	j.fields = fields
+	j.mu.Unlock()
+}
+
+// close the journal socket
+func (j *journalConn) close() error {
+	return j.conn.Close()
+}
+
+// journalEntry serializes a message and its fields in the journal's
+// native format. The message's Timestamp and StructuredData are kept in
+// the SYSLOG_TIMESTAMP and SYSLOG_STRUCTURED_DATA fields, since journald
+// stamps entries with the time it receives them.
+func journalEntry(m *Message, fields map[string]string) []byte {
+	var b []byte
+	b = appendJournalField(b, "MESSAGE", strings.TrimSuffix(m.Content, "\n"))
+	b = appendJournalField(b, "PRIORITY", strconv.Itoa(int(m.Priority&severityMask)))
+	b = appendJournalField(b, "SYSLOG_FACILITY", strconv.Itoa(int(m.Priority&facilityMask)>>3))
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", m.Tag)
+	b = appendJournalField(b, "SYSLOG_PID", strconv.Itoa(os.Getpid()))
+	if !m.Timestamp.IsZero() {
+		b = appendJournalField(b, "SYSLOG_TIMESTAMP", m.Timestamp.Format(time.RFC3339Nano))
+	}
+	if sd := formatStructuredData(m.StructuredData); sd != "" {
+		b = appendJournalField(b, "SYSLOG_STRUCTURED_DATA", sd)
+	}
+
+	if c := m.caller; c != nil {
+		b = appendJournalField(b, "CODE_FILE", c.file)
+		b = appendJournalField(b, "CODE_LINE", strconv.Itoa(c.line))
+		b = appendJournalField(b, "CODE_FUNC", c.function)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = appendJournalField(b, k, fields[k])
+	}
+	return b
+}
+
+// appendJournalField appends KEY=value and a newline. Values containing a
+// newline use the binary-safe form instead: the key, a newline, the value
+// length as a little-endian 64 bit integer, the value and a newline.
+func appendJournalField(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b = append(b, '\n')
+	b = append(b, size[:]...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// validJournalField reports whether name may be used as a custom journal
+// field: uppercase letters, digits and underscores, not starting with an
+// underscore or digit, and at most 64 characters long. Fields starting
+// with an underscore are reserved for journald's trusted fields.
+func validJournalField(name string) bool {
+	if name == "" || len(name) > 64 || name[0] == '_' || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// srslogPackage is the import path of this package, used by callerLocation
+// to skip over its own frames.
+var srslogPackage = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndex(name, "/")
+	return name[:slash+strings.Index(name[slash:], ".")]
+}()
+
+// codeLocation is the code that logged a message.
+type codeLocation struct {
+	file     string
+	line     int
+	function string
+}
+
+// callerLocation finds the code that logged the message: the first frame
+// outside this package and the standard log package. It returns nil if
+// there is none.
+func callerLocation() *codeLocation {
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, srslogPackage+".") && !strings.HasSuffix(frame.File, "_test.go")
+		if !internal && !strings.HasPrefix(frame.Function, "log.") {
+			return &codeLocation{file: frame.File, line: frame.Line, function: frame.Function}
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// SetJournalFields sets custom fields that are added to every entry sent
+// over the "journald" network. Field names must consist of uppercase
+// letters, digits and underscores and must not start with an underscore.
+func (w *Writer) SetJournalFields(fields map[string]string) error {
+	w = w.root()
+	copied := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if !validJournalField(k) {
+			return fmt.Errorf("srslog: invalid journal field name %q", k)
+		}
+		copied[k] = v
+	}
+
+	w.mu.Lock()
+	w.journalFields = copied
+	conn := w.conn
+	w.mu.Unlock()
+
+	if jc, ok := conn.(*journalConn); ok {
+		jc.setFields(copied)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+//go:build unix
+// +build unix
+
+package srslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startJournalServer listens on a unixgram socket like journald does.
+func startJournalServer(t *testing.T) (*net.UnixConn, string, func()) {
+	dir, err := ioutil.TempDir("", "srslog-journal")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "socket")
+	l, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to listen: %v", err)
+	}
+	return l, path, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// readJournalEntry reads one entry, following a passed file descriptor if
+// there is one, and parses its fields.
+func readJournalEntry(t *testing.T, l *net.UnixConn) map[string]string {
+	buf := make([]byte, 1<<20)
+	oob := make([]byte, 1024)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := l.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatalf("failed to read entry: %v", err)
+	}
+	data := buf[:n]
+
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatalf("failed to parse control message: %v", err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatalf("failed to parse rights: %v", err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "journal-fd")
+		defer f.Close()
+		f.Seek(0, 0)
+		if data, err = ioutil.ReadAll(f); err != nil {
+			t.Fatalf("failed to read passed fd: %v", err)
+		}
+	}
+	return parseJournalEntry(t, data)
+}
+
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			t.Fatalf("truncated entry: %q", data)
+		}
+		line := string(data[:nl])
+		data = data[nl+1:]
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			fields[line[:eq]] = line[eq+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[line] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestJournalWrite(t *testing.T) {
+	l, path, cleanup := startJournalServer(t)
+	defer cleanup()
+
+	w, err := Dial("journald", path, LOG_LOCAL2|LOG_INFO, "journal_test")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	if err := w.SetJournalFields(map[string]string{"REQUEST_ID": "abc"}); err != nil {
+		t.Fatalf("failed to set fields: %v", err)
+	}
+
+	if err := w.Warning("first line\nsecond line"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	_, file, _, _ := runtime.Caller(0)
+
+	fields := readJournalEntry(t, l)
+	expected := map[string]string{
+		"MESSAGE":           "first line\nsecond line",
+		"PRIORITY":          "4",
+		"SYSLOG_FACILITY":   "18",
+		"SYSLOG_IDENTIFIER": "journal_test",
+		"REQUEST_ID":        "abc",
+		"CODE_FILE":         file,
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, fields[k])
+		}
+	}
+	if !strings.HasSuffix(fields["CODE_FUNC"], "TestJournalWrite") {
+		t.Errorf("expected CODE_FUNC to be the test, got %q", fields["CODE_FUNC"])
+	}
+}
+
+func TestJournalAsyncCaller(t *testing.T) {
+	l, path, cleanup := startJournalServer(t)
+	defer cleanup()
+
+	w, err := DialWithOptions("journald", path, LOG_USER|LOG_INFO, "journal_test", WithAsync(10, OverflowBlock))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Info("queued"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	_, file, _, _ := runtime.Caller(0)
+
+	fields := readJournalEntry(t, l)
+	if fields["CODE_FILE"] != file || !strings.HasSuffix(fields["CODE_FUNC"], "TestJournalAsyncCaller") {
+		t.Errorf("expected the caller of Info, got %s in %s", fields["CODE_FUNC"], fields["CODE_FILE"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fields["SYSLOG_TIMESTAMP"]); err != nil {
+		t.Errorf("expected the time of the write, got %q", fields["SYSLOG_TIMESTAMP"])
+	}
+}
+
+func TestJournalLargeEntry(t *testing.T) {
+	l, path, cleanup := startJournalServer(t)
+	defer cleanup()
+
+	w, err := Dial("journald", path, LOG_USER|LOG_INFO, "journal_test")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	msg := strings.Repeat("x", 4<<20)
+	if err := w.Info(msg); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if fields := readJournalEntry(t, l); fields["MESSAGE"] != msg {
+		t.Errorf("expected the large message to arrive intact, got %d bytes", len(fields["MESSAGE"]))
+	}
+}
+
+func TestJournalMessageOverrides(t *testing.T) {
+	l, path, cleanup := startJournalServer(t)
+	defer cleanup()
+
+	w, err := Dial("journald", path, LOG_USER|LOG_INFO, "journal_test")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	err = w.WriteMessage(&Message{
+		Priority:       LOG_INFO,
+		Content:        "overridden",
+		Tag:            "other",
+		Timestamp:      time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		StructuredData: []SDElement{{ID: "a@1", Params: map[string]string{"k": "v"}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	fields := readJournalEntry(t, l)
+	expected := map[string]string{
+		"SYSLOG_IDENTIFIER":      "other",
+		"SYSLOG_TIMESTAMP":       "2020-01-02T03:04:05Z",
+		"SYSLOG_STRUCTURED_DATA": `[a@1 k="v"]`,
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, fields[k])
+		}
+	}
+}
+
+func TestJournalDialFails(t *testing.T) {
+	if _, err := Dial("journald", "/nonexistent/journal/socket", LOG_ERR, "tag"); err == nil {
+		t.Errorf("should fail to dial a missing socket")
+	}
+}
+
+func TestSetJournalFieldsInvalid(t *testing.T) {
+	w := Writer{}
+	for _, name := range []string{"", "lower", "_TRUSTED", "1ST", "WITH-DASH", strings.Repeat("A", 65)} {
+		if err := w.SetJournalFields(map[string]string{name: "x"}); err == nil {
+			t.Errorf("should reject field name %q", name)
+		}
+	}
+	if err := w.SetJournalFields(map[string]string{"OK_FIELD_2": "x"}); err != nil {
+		t.Errorf("should accept a valid field name: %v", err)
+	}
+}
+
+func TestAppendJournalField(t *testing.T) {
+	if out := string(appendJournalField(nil, "KEY", "value")); out != "KEY=value\n" {
+		t.Errorf("unexpected simple field %q", out)
+	}
+	out := appendJournalField(nil, "KEY", "a\nb")
+	expected := []byte("KEY\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n")
+	if !bytes.Equal(out, expected) {
+		t.Errorf("unexpected binary-safe field %q", out)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build unix
+// +build unix
+
+package srslog
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+)
+
+// isMessageTooLong reports whether a datagram write failed because the
+// entry does not fit in a single datagram.
+func isMessageTooLong(err error) bool {
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// sendJournalFD writes entry to an in-memory file and passes its descriptor
+// to journald with SCM_RIGHTS, which is how the native protocol carries
+// entries too large for a datagram.
+func sendJournalFD(conn *net.UnixConn, entry []byte) error {
+	f, err := journalFile(entry)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// WriteMsgUnix refuses connected datagram sockets, so send the
+	// descriptor with sendmsg directly.
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	var sendErr error
+	err = rc.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// shmJournalFile writes entry to an unlinked file in /dev/shm. journald
+// only accepts unsealed files that live in memory, so there is no fallback
+// to other directories.
+func shmJournalFile(entry []byte) (*os.File, error) {
+	f, err := ioutil.TempFile("/dev/shm", "srslog-journal")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if _, err := f.Write(entry); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
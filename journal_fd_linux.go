@@ -0,0 +1,75 @@
+package srslog
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// sysMemfdCreate is the memfd_create system call, which the syscall package
+// does not define on every architecture. It is zero where it is unknown.
+var sysMemfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}[runtime.GOARCH]
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+
+	fAddSeals   = 1033
+	fGetSeals   = 1034
+	fSealSeal   = 0x1
+	fSealShrink = 0x2
+	fSealGrow   = 0x4
+	fSealWrite  = 0x8
+)
+
+// journalFile returns a file holding entry for sendJournalFD. It is a
+// sealed memfd, which journald prefers, or an unlinked file in /dev/shm on
+// kernels without sealing.
+func journalFile(entry []byte) (*os.File, error) {
+	if f, err := memfdJournalFile(entry); err == nil {
+		return f, nil
+	}
+	return shmJournalFile(entry)
+}
+
+// memfdJournalFile writes entry to a memfd and seals it, so journald can
+// map it without fearing that it changes.
+func memfdJournalFile(entry []byte) (*os.File, error) {
+	if sysMemfdCreate == 0 {
+		return nil, syscall.ENOSYS
+	}
+	name, err := syscall.BytePtrFromString("srslog-journal")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(sysMemfdCreate, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("memfd_create", errno)
+	}
+	f := os.NewFile(fd, "srslog-journal")
+	if _, err := f.Write(entry); err != nil {
+		f.Close()
+		return nil, err
+	}
+	seals := uintptr(fSealSeal | fSealShrink | fSealGrow | fSealWrite)
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, seals); errno != 0 {
+		f.Close()
+		return nil, os.NewSyscallError("fcntl", errno)
+	}
+	return f, nil
+}
@@ -0,0 +1,34 @@
+package srslog
+
+import (
+	"io/ioutil"
+	"syscall"
+	"testing"
+)
+
+func TestJournalFileSealed(t *testing.T) {
+	if sysMemfdCreate == 0 {
+		t.Skip("memfd_create is unknown on this architecture")
+	}
+	f, err := memfdJournalFile([]byte("MESSAGE=large\n"))
+	if err != nil {
+		t.Skipf("memfd sealing is unavailable: %v", err)
+	}
+	defer f.Close()
+
+	seals, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fGetSeals, 0)
+	if errno != 0 {
+		t.Fatalf("failed to get seals: %v", errno)
+	}
+	if want := uintptr(fSealSeal | fSealShrink | fSealGrow | fSealWrite); seals&want != want {
+		t.Errorf("expected seals %#x, got %#x", want, seals)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Errorf("expected writes to the sealed file to fail")
+	}
+
+	f.Seek(0, 0)
+	if data, err := ioutil.ReadAll(f); err != nil || string(data) != "MESSAGE=large\n" {
+		t.Errorf("expected the entry, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+// +build !unix
+
+package srslog
+
+import (
+	"errors"
+	"net"
+)
+
+func isMessageTooLong(err error) bool {
+	return false
+}
+
+func sendJournalFD(conn *net.UnixConn, entry []byte) error {
+	return errors.New("srslog: journal entries too large for a datagram are not supported")
+}
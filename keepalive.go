@@ -0,0 +1,53 @@
+package srslog
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WithKeepAlive sets the TCP keep-alive probes of network connections, so
+// that a collector which silently went away is noticed even while nothing
+// is logged. Without it Go's defaults apply.
+func WithKeepAlive(config net.KeepAliveConfig) Option {
+	return func(w *Writer) error {
+		w.keepAlive = &config
+		return nil
+	}
+}
+
+// WithTCPUserTimeout sets TCP_USER_TIMEOUT on network connections: the
+// kernel drops a connection when data it sent stays unacknowledged for
+// longer than d, and the next write fails and reconnects. It is only
+// supported on Linux; elsewhere the Option returns an error, so
+// DialWithOptions, DialContext and the other functions given it fail
+// before dialing.
+func WithTCPUserTimeout(d time.Duration) Option {
+	return func(w *Writer) error {
+		if !tcpUserTimeoutSupported {
+			return errTCPUserTimeoutUnsupported
+		}
+		w.tcpUserTimeout = d
+		return nil
+	}
+}
+
+// controlSocket returns a net.Dialer Control function that applies the
+// Writer's socket options to TCP sockets, or nil if there are none.
+func (w *Writer) controlSocket() func(network, address string, c syscall.RawConn) error {
+	timeout := w.tcpUserTimeout
+	if timeout <= 0 {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if !strings.HasPrefix(network, "tcp") {
+			return nil
+		}
+		var err error
+		if cerr := c.Control(func(fd uintptr) { err = setTCPUserTimeout(fd, timeout) }); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
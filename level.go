@@ -0,0 +1,205 @@
+package srslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+var severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var facilityNames = map[string]Priority{
+	"kern": LOG_KERN, "user": LOG_USER, "mail": LOG_MAIL, "daemon": LOG_DAEMON,
+	"auth": LOG_AUTH, "syslog": LOG_SYSLOG, "lpr": LOG_LPR, "news": LOG_NEWS,
+	"uucp": LOG_UUCP, "cron": LOG_CRON, "authpriv": LOG_AUTHPRIV, "ftp": LOG_FTP,
+	"local0": LOG_LOCAL0, "local1": LOG_LOCAL1, "local2": LOG_LOCAL2, "local3": LOG_LOCAL3,
+	"local4": LOG_LOCAL4, "local5": LOG_LOCAL5, "local6": LOG_LOCAL6, "local7": LOG_LOCAL7,
+}
+
+// ParseSeverity returns the severity with the given name, as used by
+// syslog.conf: "emerg", "alert", "crit", "err", "warning", "notice", "info"
+// or "debug". "panic", "error" and "warn" are accepted too.
+func ParseSeverity(name string) (Priority, error) {
+	name = strings.ToLower(name)
+	switch name {
+	case "panic":
+		return LOG_EMERG, nil
+	case "error":
+		return LOG_ERR, nil
+	case "warn":
+		return LOG_WARNING, nil
+	}
+	for i, n := range severityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+	return 0, fmt.Errorf("srslog: unknown severity %q", name)
+}
+
+// ParseFacility returns the facility with the given name, as used by
+// syslog.conf, such as "daemon" or "local0".
+func ParseFacility(name string) (Priority, error) {
+	if f, ok := facilityNames[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return 0, fmt.Errorf("srslog: unknown facility %q", name)
+}
+
+func severityName(p Priority) string {
+	return severityNames[p&severityMask]
+}
+
+// levels holds the severity thresholds of a Writer. Each is stored as the
+// severity plus one, so that zero means unset.
+type levels struct {
+	level      atomic.Int32
+	facilities [facilityMask>>3 + 1]atomic.Int32
+}
+
+// enabled reports whether messages of priority p pass the thresholds. It
+// is called before anything is formatted.
+func (w *Writer) enabled(p Priority) bool {
+	w = w.root()
+	if f := &w.levels.facilities[(p&facilityMask)>>3]; f.Load() != 0 {
+		return int32(p&severityMask) < f.Load()
+	}
+	if l := w.levels.level.Load(); l != 0 {
+		return int32(p&severityMask) < l
+	}
+	return true
+}
+
+// WithLevel sets the initial minimum severity of the Writer, see SetLevel.
+func WithLevel(severity Priority) Option {
+	return func(w *Writer) error {
+		w.SetLevel(severity)
+		return nil
+	}
+}
+
+// SetLevel sets the least severe messages the Writer sends: messages less
+// severe than severity are dropped before they are formatted. The default
+// is LOG_DEBUG, which sends everything. It is safe to call while other
+// goroutines write.
+func (w *Writer) SetLevel(severity Priority) {
+	w = w.root()
+	w.levels.level.Store(int32(severity&severityMask) + 1)
+}
+
+// Level returns the least severe messages the Writer sends, see SetLevel.
+func (w *Writer) Level() Priority {
+	w = w.root()
+	if l := w.levels.level.Load(); l != 0 {
+		return Priority(l - 1)
+	}
+	return LOG_DEBUG
+}
+
+// SetFacilityLevel sets the least severe messages the Writer sends for a
+// facility, overriding SetLevel for messages of that facility.
+func (w *Writer) SetFacilityLevel(facility, severity Priority) {
+	w = w.root()
+	w.levels.facilities[(facility&facilityMask)>>3].Store(int32(severity&severityMask) + 1)
+}
+
+// ClearFacilityLevel removes the threshold of a facility, so that its
+// messages follow SetLevel again.
+func (w *Writer) ClearFacilityLevel(facility Priority) {
+	w = w.root()
+	w.levels.facilities[(facility&facilityMask)>>3].Store(0)
+}
+
+// FacilityLevel returns the least severe messages the Writer sends for a
+// facility, see SetFacilityLevel.
+func (w *Writer) FacilityLevel(facility Priority) Priority {
+	w = w.root()
+	if l := w.levels.facilities[(facility&facilityMask)>>3].Load(); l != 0 {
+		return Priority(l - 1)
+	}
+	return w.Level()
+}
+
+// raiseLevel makes the Writer send one more severity, and lowerLevel one
+// less, within LOG_EMERG and LOG_DEBUG.
+func (w *Writer) raiseLevel() {
+	if l := w.Level(); l < LOG_DEBUG {
+		w.SetLevel(l + 1)
+	}
+}
+
+func (w *Writer) lowerLevel() {
+	if l := w.Level(); l > LOG_EMERG {
+		w.SetLevel(l - 1)
+	}
+}
+
+// levelRequest is the body of requests to the LevelHandler.
+type levelRequest struct {
+	Level    string `json:"level"`
+	Facility string `json:"facility,omitempty"`
+}
+
+// LevelHandler returns an http.Handler that reads and changes the Writer's
+// level at runtime. GET returns it as JSON, such as {"level":"info"}; PUT and
+// POST set it from a body of the same form or from form values. A
+// "facility" field or form value, such as "local0", reads or sets the
+// threshold of that facility instead.
+func (w *Writer) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req levelRequest
+		switch r.Method {
+		case http.MethodGet:
+			req.Facility = r.FormValue("facility")
+		case http.MethodPut, http.MethodPost:
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					writeLevelError(rw, http.StatusBadRequest, err)
+					return
+				}
+			} else {
+				req.Level, req.Facility = r.FormValue("level"), r.FormValue("facility")
+			}
+		default:
+			rw.Header().Set("Allow", "GET, PUT, POST")
+			writeLevelError(rw, http.StatusMethodNotAllowed, fmt.Errorf("srslog: method %s not allowed", r.Method))
+			return
+		}
+
+		var facility Priority
+		if req.Facility != "" {
+			var err error
+			if facility, err = ParseFacility(req.Facility); err != nil {
+				writeLevelError(rw, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if r.Method != http.MethodGet {
+			severity, err := ParseSeverity(req.Level)
+			if err != nil {
+				writeLevelError(rw, http.StatusBadRequest, err)
+				return
+			}
+			if req.Facility != "" {
+				w.SetFacilityLevel(facility, severity)
+			} else {
+				w.SetLevel(severity)
+			}
+		}
+
+		resp := levelRequest{Level: severityName(w.Level()), Facility: req.Facility}
+		if req.Facility != "" {
+			resp.Level = severityName(w.FacilityLevel(facility))
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(resp)
+	})
+}
+
+func writeLevelError(rw http.ResponseWriter, code int, err error) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(map[string]string{"error": err.Error()})
+}
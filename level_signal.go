@@ -0,0 +1,36 @@
+//go:build unix
+// +build unix
+
+package srslog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleLevelSignals makes the Writer send one more severity each time the
+// process receives SIGUSR1, and one less on SIGUSR2, until stop is called.
+func (w *Writer) HandleLevelSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					w.raiseLevel()
+				} else {
+					w.lowerLevel()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
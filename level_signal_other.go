@@ -0,0 +1,10 @@
+//go:build !unix
+// +build !unix
+
+package srslog
+
+// HandleLevelSignals does nothing on this platform, which has no SIGUSR1
+// and SIGUSR2.
+func (w *Writer) HandleLevelSignals() (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+// +build unix
+
+package srslog
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleLevelSignals(t *testing.T) {
+	w := &Writer{}
+	w.SetLevel(LOG_NOTICE)
+	stop := w.HandleLevelSignals()
+	defer stop()
+
+	waitLevel := func(want Priority) {
+		deadline := time.Now().Add(2 * time.Second)
+		for w.Level() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected level %v, got %v", want, w.Level())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	waitLevel(LOG_INFO)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	waitLevel(LOG_NOTICE)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	waitLevel(LOG_WARNING)
+}
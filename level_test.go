@@ -0,0 +1,149 @@
+package srslog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	w := &Writer{}
+	if w.Level() != LOG_DEBUG || !w.enabled(LOG_DEBUG|LOG_LOCAL0) {
+		t.Fatalf("a new Writer should send everything")
+	}
+
+	w.SetLevel(LOG_WARNING)
+	if w.Level() != LOG_WARNING {
+		t.Errorf("expected LOG_WARNING, got %v", w.Level())
+	}
+	if !w.enabled(LOG_WARNING|LOG_DAEMON) || w.enabled(LOG_NOTICE|LOG_DAEMON) {
+		t.Errorf("expected LOG_WARNING and more severe messages only")
+	}
+
+	w.SetFacilityLevel(LOG_LOCAL0, LOG_DEBUG)
+	w.SetFacilityLevel(LOG_AUTH, LOG_EMERG)
+	if !w.enabled(LOG_DEBUG|LOG_LOCAL0) || w.enabled(LOG_ALERT|LOG_AUTH) || w.enabled(LOG_INFO|LOG_DAEMON) {
+		t.Errorf("facility levels should override the level")
+	}
+	if w.FacilityLevel(LOG_LOCAL0) != LOG_DEBUG || w.FacilityLevel(LOG_DAEMON) != LOG_WARNING {
+		t.Errorf("unexpected facility levels")
+	}
+	w.ClearFacilityLevel(LOG_LOCAL0)
+	if w.enabled(LOG_DEBUG | LOG_LOCAL0) {
+		t.Errorf("a cleared facility should follow the level")
+	}
+
+	w.SetLevel(LOG_EMERG)
+	w.lowerLevel()
+	w.raiseLevel()
+	w.raiseLevel()
+	if w.Level() != LOG_CRIT {
+		t.Errorf("expected LOG_CRIT, got %v", w.Level())
+	}
+}
+
+func TestLevelUnknownFacilities(t *testing.T) {
+	w := &Writer{}
+	w.SetLevel(LOG_ERR)
+	for _, p := range []Priority{0xff, 0xc0 | LOG_ERR, 0xf8 | LOG_DEBUG} {
+		if w.enabled(p) != (p&severityMask <= LOG_ERR) {
+			t.Errorf("unexpected result for priority %#x", int(p))
+		}
+	}
+	w.SetFacilityLevel(0xf8, LOG_DEBUG)
+	if !w.enabled(0xff) || w.FacilityLevel(0xf8) != LOG_DEBUG {
+		t.Errorf("facilities above LOG_LOCAL7 should have levels too")
+	}
+	w.ClearFacilityLevel(0xf8)
+	if w.enabled(0xff) {
+		t.Errorf("a cleared facility should follow the level")
+	}
+}
+
+func TestLevelWriter(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_INFO, "tag", WithLevel(LOG_WARNING))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Debug("dropped"); err != nil {
+		t.Errorf("dropped messages should not fail: %v", err)
+	}
+	if n, err := w.Write([]byte("dropped too")); n != 11 || err != nil {
+		t.Errorf("expected Write to report the message written, got %d, %v", n, err)
+	}
+	w.Err("sent")
+	w.WriteWithPriority(LOG_WARNING, []byte("sent too"))
+	s.receiveNext(t, "sent")
+	s.receiveNext(t, "sent too")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		w.Debug("dropped")
+		w.Write([]byte("dropped"))
+	})
+	if allocs != 0 {
+		t.Errorf("dropped messages should not allocate, got %v allocations", allocs)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	w := &Writer{}
+	h := w.LevelHandler()
+	do := func(method, target, contentType, body string) (int, string) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	if code, body := do("GET", "/", "", ""); code != http.StatusOK || body != `{"level":"debug"}` {
+		t.Errorf("GET: %d %s", code, body)
+	}
+	if code, body := do("PUT", "/", "application/json", `{"level":"warning"}`); code != http.StatusOK || body != `{"level":"warning"}` {
+		t.Errorf("PUT: %d %s", code, body)
+	}
+	if w.Level() != LOG_WARNING {
+		t.Errorf("expected the level to change, got %v", w.Level())
+	}
+	if code, body := do("POST", "/", "application/x-www-form-urlencoded", "level=debug&facility=local0"); code != http.StatusOK || body != `{"level":"debug","facility":"local0"}` {
+		t.Errorf("POST: %d %s", code, body)
+	}
+	if w.FacilityLevel(LOG_LOCAL0) != LOG_DEBUG || w.Level() != LOG_WARNING {
+		t.Errorf("expected only the facility level to change")
+	}
+	if code, body := do("GET", "/?facility=local0", "", ""); code != http.StatusOK || body != `{"level":"debug","facility":"local0"}` {
+		t.Errorf("GET facility: %d %s", code, body)
+	}
+
+	if code, _ := do("PUT", "/", "application/json", `{"level":"loud"}`); code != http.StatusBadRequest {
+		t.Errorf("expected an unknown level to be rejected, got %d", code)
+	}
+	if code, _ := do("PUT", "/", "application/json", `{"level":"info","facility":"nope"}`); code != http.StatusBadRequest {
+		t.Errorf("expected an unknown facility to be rejected, got %d", code)
+	}
+	if code, _ := do("DELETE", "/", "", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected DELETE to be rejected, got %d", code)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for name, want := range map[string]Priority{"emerg": LOG_EMERG, "ERR": LOG_ERR, "error": LOG_ERR, "warn": LOG_WARNING, "debug": LOG_DEBUG} {
+		if got, err := ParseSeverity(name); err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v, %v", name, want, got, err)
+		}
+	}
+	if _, err := ParseSeverity("verbose"); err == nil {
+		t.Errorf("expected an error for an unknown severity")
+	}
+	if f, err := ParseFacility("Local3"); err != nil || f != LOG_LOCAL3 {
+		t.Errorf("expected LOG_LOCAL3, got %v, %v", f, err)
+	}
+}
@@ -0,0 +1,105 @@
+package srslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalFormat selects the wire format used when talking to the local
+// syslog daemon. It only applies while no Formatter has been set with
+// SetFormatter.
+type LocalFormat int
+
+const (
+	// LocalFormatUnix uses the UnixFormatter, the traditional format
+	// every local daemon understands. This is the default.
+	LocalFormatUnix LocalFormat = iota
+
+	// LocalFormatRFC3164 uses the RFC3164Formatter.
+	LocalFormatRFC3164
+
+	// LocalFormatRFC5424 uses the RFC5424Formatter, which modern rsyslog
+	// and syslog-ng accept on /dev/log.
+	LocalFormatRFC5424
+
+	// LocalFormatAuto picks a format based on the daemon behind the
+	// socket, see detectLocalFormat.
+	LocalFormatAuto
+)
+
+func (f LocalFormat) String() string {
+	switch f {
+	case LocalFormatUnix:
+		return "unix"
+	case LocalFormatRFC3164:
+		return "rfc3164"
+	case LocalFormatRFC5424:
+		return "rfc5424"
+	case LocalFormatAuto:
+		return "auto"
+	}
+	return "unknown"
+}
+
+// formatter returns the MessageFormatter for a resolved format.
+func (f LocalFormat) formatter() MessageFormatter {
+	switch f {
+	case LocalFormatRFC3164:
+		return RFC3164MessageFormatter
+	case LocalFormatRFC5424:
+		return RFC5424MessageFormatter
+	}
+	return UnixMessageFormatter
+}
+
+// journaldSocketDir is where systemd-journald keeps its sockets. When
+// /dev/log is a link into it, journald is the daemon reading it.
+var journaldSocketDir = "/run/systemd/"
+
+// rfc5424DaemonPidFiles are pid files of daemons that accept RFC 5424 on
+// their local socket.
+var rfc5424DaemonPidFiles = []string{
+	"/run/rsyslogd.pid",
+	"/var/run/rsyslogd.pid",
+	"/run/syslog-ng.pid",
+	"/var/run/syslog-ng.pid",
+}
+
+// detectLocalFormat guesses which format the daemon listening on path
+// accepts. systemd-journald only parses the traditional format, and it
+// owns /dev/log even when rsyslog runs behind it, so a socket inside
+// journaldSocketDir always gets LocalFormatUnix. Otherwise RFC 5424 is
+// used if rsyslog or syslog-ng appears to be running.
+func detectLocalFormat(path string) LocalFormat {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil && strings.HasPrefix(resolved, journaldSocketDir) {
+		return LocalFormatUnix
+	}
+	for _, pidFile := range rfc5424DaemonPidFiles {
+		if _, err := os.Stat(pidFile); err == nil {
+			return LocalFormatRFC5424
+		}
+	}
+	return LocalFormatUnix
+}
+
+// WithLocalFormat sets the format used for the local syslog daemon and the
+// "unix" and "unixgram" networks. LocalFormatAuto detects it each time
+// the Writer connects.
+func WithLocalFormat(f LocalFormat) Option {
+	return func(w *Writer) error {
+		w.localFormat = f
+		return nil
+	}
+}
+
+// LocalFormat returns the format in use for the current local connection.
+// Once connected it never returns LocalFormatAuto, so it reports what was
+// detected. For non-local networks it returns the configured format.
+func (w *Writer) LocalFormat() LocalFormat {
+	w = w.root()
+	if lc, ok := w.getConn().(*localConn); ok {
+		return lc.format
+	}
+	return w.localFormat
+}
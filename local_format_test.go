@@ -0,0 +1,118 @@
+package srslog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalFormatWrite(t *testing.T) {
+	tests := []struct {
+		format LocalFormat
+		f      Formatter
+	}{
+		{LocalFormatUnix, UnixFormatter},
+		{LocalFormatRFC3164, RFC3164Formatter},
+		{LocalFormatRFC5424, RFC5424Formatter},
+	}
+
+	for _, test := range tests {
+		done := make(chan string)
+		addr, sock, srvWG := startServer("unixgram", "", done)
+
+		w, err := DialWithOptions("unixgram", addr, LOG_ERR, "tag", WithLocalFormat(test.format))
+		if err != nil {
+			t.Fatalf("%v: failed to dial: %v", test.format, err)
+		}
+		w.SetHostname("hostname")
+		if w.LocalFormat() != test.format {
+			t.Errorf("expected LocalFormat %v, got %v", test.format, w.LocalFormat())
+		}
+
+		expected := test.f(LOG_ERR, "hostname", "tag", "local message") + "\n"
+		w.Err("local message")
+		if sent := <-done; sent != expected {
+			t.Errorf("%v: expected %q, got %q", test.format, expected, sent)
+		}
+
+		w.Close()
+		sock.Close()
+		srvWG.Wait()
+		os.Remove(addr)
+	}
+}
+
+func TestLocalFormatFormatterWins(t *testing.T) {
+	messages := make([]string, 0)
+	lc := localConn{conn: newTestLocalConn(&messages), format: LocalFormatRFC5424}
+
+	lc.writeString(context.Background(), nil, DefaultMessageFormatter, &Message{Priority: LOG_ERR, Hostname: "hostname", Tag: "tag", Content: "content"})
+	if messages[0] != DefaultFormatter(LOG_ERR, "hostname", "tag", "content") {
+		t.Errorf("an explicit formatter should override the local format, got %q", messages[0])
+	}
+}
+
+func TestDetectLocalFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srslog-detect")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(d string, p []string) {
+		journaldSocketDir, rfc5424DaemonPidFiles = d, p
+	}(journaldSocketDir, rfc5424DaemonPidFiles)
+
+	journald := filepath.Join(dir, "systemd")
+	os.Mkdir(journald, 0755)
+	ioutil.WriteFile(filepath.Join(journald, "dev-log"), nil, 0644)
+	os.Symlink(filepath.Join(journald, "dev-log"), filepath.Join(dir, "log"))
+	pidFile := filepath.Join(dir, "rsyslogd.pid")
+	journaldSocketDir = journald + "/"
+	rfc5424DaemonPidFiles = []string{pidFile}
+
+	if f := detectLocalFormat(filepath.Join(dir, "plain")); f != LocalFormatUnix {
+		t.Errorf("expected unix without a known daemon, got %v", f)
+	}
+
+	ioutil.WriteFile(pidFile, []byte("1\n"), 0644)
+	if f := detectLocalFormat(filepath.Join(dir, "plain")); f != LocalFormatRFC5424 {
+		t.Errorf("expected rfc5424 with rsyslog running, got %v", f)
+	}
+	if f := detectLocalFormat(filepath.Join(dir, "log")); f != LocalFormatUnix {
+		t.Errorf("expected unix when journald owns the socket, got %v", f)
+	}
+}
+
+func TestLocalFormatAutoResolves(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("unixgram", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+	defer os.Remove(addr)
+
+	w, err := DialWithOptions("", "", LOG_ERR, "tag", WithLocalSocketPaths(addr), WithLocalFormat(LocalFormatAuto))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	if f := w.LocalFormat(); f == LocalFormatAuto {
+		t.Errorf("expected the format to be resolved, got %v", f)
+	}
+}
+
+func TestLocalFormatString(t *testing.T) {
+	for f, s := range map[LocalFormat]string{
+		LocalFormatUnix:    "unix",
+		LocalFormatRFC3164: "rfc3164",
+		LocalFormatRFC5424: "rfc5424",
+		LocalFormatAuto:    "auto",
+		LocalFormat(42):    "unknown",
+	} {
+		if f.String() != s {
+			t.Errorf("expected %q, got %q", s, f.String())
+		}
+	}
+}
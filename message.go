@@ -0,0 +1,108 @@
+package srslog
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrOverrideUnsupported is returned for messages with a Timestamp or
+// StructuredData when the Writer's formatter was set with SetFormatter to a
+// Formatter of another package, since a Formatter is given neither. Use
+// SetMessageFormatter instead.
+var ErrOverrideUnsupported = errors.New("srslog: the formatter cannot send the message's timestamp or structured data")
+
+// Message is a syslog message for WriteMessage and WriteBatch. Priority is
+// the facility and severity of the message, as with WriteWithPriority.
+// Hostname, Tag and Timestamp override those of the Writer for this message
+// only; empty or zero fields use the Writer's hostname and tag and the
+// current time. StructuredData is sent by RFC5424MessageFormatter and the
+// "journald" network, and ignored by formats without a place for it.
+// Formatters of other packages set with SetFormatter cannot send Timestamp
+// or StructuredData, see ErrOverrideUnsupported.
+type Message struct {
+	Priority       Priority
+	Content        string
+	Hostname       string
+	Tag            string
+	Timestamp      time.Time
+	StructuredData []SDElement
+
+	// set by capture: where the message was logged, for journald, and
+	// whether Timestamp is the time it was written rather than an
+	// override
+	caller  *codeLocation
+	written bool
+
+	// set by stamp if StructuredData is only that of a derived Writer,
+	// which formats without structured data drop instead of failing
+	inherited bool
+}
+
+// WriteMessage sends m over the Writer's connection, with the same filters,
+// retries, queueing and spooling as WriteWithPriority. It lets one Writer
+// send messages with different tags, hostnames, facilities and timestamps.
+// m is not modified or retained.
+func (w *Writer) WriteMessage(m *Message) error {
+	return w.WriteMessageContext(context.Background(), m)
+}
+
+// WriteMessageContext is WriteMessage bounded by ctx.
+func (w *Writer) WriteMessageContext(ctx context.Context, m *Message) error {
+	if !w.enabled(m.Priority) {
+		return nil
+	}
+	_, err := w.writeMessage(ctx, *m)
+	return err
+}
+
+// resolve fills in the headers a message does not override from the
+// Writer.
+func (w *Writer) resolve(m Message) Message {
+	if m.Hostname == "" {
+		m.Hostname = w.getHostname()
+	}
+	m.Tag = w.tagOf(m)
+	return m
+}
+
+// tagOf returns the tag a message is sent with.
+func (w *Writer) tagOf(m Message) string {
+	if m.Tag != "" {
+		return m.Tag
+	}
+	return w.tag
+}
+
+// checkOverrides returns ErrOverrideUnsupported if m has a Timestamp or
+// StructuredData that the Writer's Formatter cannot send. Structured data
+// inherited from a derived Writer is dropped instead.
+func (w *Writer) checkOverrides(m *Message) error {
+	override := !m.Timestamp.IsZero() && !m.written
+	sd := len(m.StructuredData) > 0 && !m.inherited
+	if w.plainFormatter && w.network != "journald" && (override || sd) {
+		return ErrOverrideUnsupported
+	}
+	return nil
+}
+
+// capture stamps a message with the time it is written and, on the
+// "journald" network, the code that wrote it, so that they stay right when
+// the message is queued, retried or spooled and sent later by another
+// goroutine.
+func (w *Writer) capture(m *Message) {
+	if m.Timestamp.IsZero() {
+		m.Timestamp, m.written = time.Now(), true
+	}
+	if w.network == "journald" && m.caller == nil {
+		m.caller = callerLocation()
+	}
+}
+
+// time returns the time a message is stamped with.
+func (m *Message) time() time.Time {
+	if m.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return m.Timestamp
+}
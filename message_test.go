@@ -0,0 +1,151 @@
+package srslog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteMessageOverrides(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetMessageFormatter(RFC5424MessageFormatter)
+	w.SetHostname("base")
+
+	stamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = w.WriteMessage(&Message{
+		Priority:  LOG_LOCAL3 | LOG_NOTICE,
+		Content:   "tenant message",
+		Hostname:  "tenant-a",
+		Tag:       "app-a",
+		Timestamp: stamp,
+	})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := w.WriteMessage(&Message{Priority: LOG_ERR, Content: "plain"}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	for _, want := range [][]string{
+		{fmt.Sprintf("<%d>1 2020-01-02T03:04:05Z tenant-a ", LOG_LOCAL3|LOG_NOTICE), " app-a - tenant message\n"},
+		{fmt.Sprintf("<%d>1 ", LOG_ERR), " base ", " tag - plain\n"},
+	} {
+		select {
+		case m := <-s.msgs:
+			for _, part := range want {
+				if !strings.Contains(m, part) {
+					t.Errorf("expected %q in %q", part, m)
+				}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
+
+func TestWriteMessageFormatters(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	stamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	sd := []SDElement{{ID: "a@1"}}
+	w.SetFormatter(func(p Priority, hostname, tag, content string) string {
+		return content
+	})
+	if err := w.WriteMessage(&Message{Priority: LOG_ERR, Content: "x", Timestamp: stamp}); err != ErrOverrideUnsupported {
+		t.Errorf("expected ErrOverrideUnsupported for a timestamp, got %v", err)
+	}
+	if err := w.WriteBatch([]Message{{Priority: LOG_ERR, Content: "x", StructuredData: sd}}); err != ErrOverrideUnsupported {
+		t.Errorf("expected ErrOverrideUnsupported for structured data, got %v", err)
+	}
+
+	w.SetMessageFormatter(func(m *Message) string {
+		return fmt.Sprintf("%s %s %s", m.Timestamp.Format(time.RFC3339), formatStructuredData(m.StructuredData), m.Content)
+	})
+	if err := w.WriteMessage(&Message{Priority: LOG_ERR, Content: "custom", Timestamp: stamp, StructuredData: sd}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	s.receiveNext(t, "2020-01-02T03:04:05Z [a@1] custom")
+
+	// the package's own Formatters are given the whole message
+	w.SetFormatter(RFC5424Formatter)
+	if err := w.WriteMessage(&Message{Priority: LOG_ERR, Content: "rfc5424", Timestamp: stamp, StructuredData: sd}); err != nil {
+		t.Fatalf("failed to write with RFC5424Formatter: %v", err)
+	}
+	select {
+	case m := <-s.msgs:
+		if !strings.Contains(m, " 2020-01-02T03:04:05Z ") || !strings.HasSuffix(m, " [a@1] rfc5424\n") {
+			t.Errorf("expected the timestamp and structured data, got %q", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the message")
+	}
+}
+
+func TestWriteBatchOverrides(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetHostname("base")
+
+	err = w.WriteBatch([]Message{
+		{Priority: LOG_ERR, Content: "one", Tag: "first"},
+		{Priority: LOG_ERR, Content: "two", Hostname: "other"},
+	})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	s.receiveNext(t, fmt.Sprintf("base first[%d]: one", os.Getpid()))
+	s.receiveNext(t, fmt.Sprintf("other tag[%d]: two", os.Getpid()))
+}
+
+func TestSetHostnameWhileWriting(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := Dial("tcp", s.addr, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			w.SetHostname(fmt.Sprintf("host%d", i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			w.Err("racing")
+		}
+	}()
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		s.receiveNext(t, "racing")
+	}
+}
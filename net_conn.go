@@ -1,25 +1,65 @@
 package srslog
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net"
+	"time"
 )
 
+// errServerClosed is returned by writes on a stream connection that the
+// server has already closed, so the Writer reconnects before sending.
+var errServerClosed = errors.New("srslog: connection closed by the server")
+
 // netConn has an internal net.Conn and adheres to the serverConn interface,
 // allowing us to send syslog messages over the network.
 type netConn struct {
-	conn net.Conn
+	conn         net.Conn
+	writeTimeout time.Duration
+
+	// closed once the server closes a stream connection, nil for datagrams
+	gone chan struct{}
+}
+
+// newNetConn returns a netConn for c. Stream connections are watched in
+// the background: a write into the kernel buffer of a connection the
+// server has closed usually succeeds, and the message is lost.
+func newNetConn(c net.Conn, writeTimeout time.Duration) *netConn {
+	n := &netConn{conn: c, writeTimeout: writeTimeout}
+	if addr := c.LocalAddr(); addr != nil {
+		switch addr.Network() {
+		case "tcp", "tcp4", "tcp6", "unix":
+			n.gone = make(chan struct{})
+			go n.watch()
+		}
+	}
+	return n
+}
+
+// watch reads from the connection until it fails. Syslog servers don't
+// send anything, so this only returns on EOF, a reset or a local close.
+func (n *netConn) watch() {
+	io.Copy(io.Discard, n.conn)
+	close(n.gone)
 }
 
 // writeString formats syslog messages using time.RFC3339 and includes the
 // hostname, and sends the message to the connection.
-func (n *netConn) writeString(framer Framer, formatter Formatter, p Priority, hostname, tag, msg string) error {
+func (n *netConn) writeString(ctx context.Context, framer Framer, formatter MessageFormatter, m *Message) error {
 	if framer == nil {
 		framer = DefaultFramer
 	}
 	if formatter == nil {
-		formatter = DefaultFormatter
+		formatter = DefaultMessageFormatter
+	}
+	formattedMessage := framer(formatter(m))
+	select {
+	case <-n.gone:
+		return errServerClosed
+	default:
 	}
-	formattedMessage := framer(formatter(p, hostname, tag, msg))
+	defer setWriteDeadline(ctx, n.conn, n.writeTimeout)()
 	_, err := n.conn.Write([]byte(formattedMessage))
 	return err
 }
@@ -0,0 +1,79 @@
+package srslog
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReconnectsBeforeWritingToClosedConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	received := make(chan string, 10)
+	go func() {
+		for n := 0; ; n++ {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn, first bool) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					received <- line
+					if first {
+						// Hang up after the first message, like a
+						// collector that restarts.
+						return
+					}
+				}
+			}(c, n == 0)
+		}
+	}()
+
+	w, err := Dial("tcp", l.Addr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("before close")
+	checkWithPriorityAndTag(t, LOG_ERR, "tag", w.hostname, "before close", <-received)
+
+	nc := w.getConn().(*netConn)
+	select {
+	case <-nc.gone:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("did not notice that the server closed the connection")
+	}
+
+	if err := w.Err("after close"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	select {
+	case line := <-received:
+		checkWithPriorityAndTag(t, LOG_ERR, "tag", w.hostname, "after close", line)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the message after the close was lost")
+	}
+}
+
+func TestNetConnWatchesOnlyStreams(t *testing.T) {
+	c, err := net.Dial("udp", "127.0.0.1:514")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	nc := newNetConn(c, 0)
+	defer nc.close()
+	if nc.gone != nil {
+		t.Errorf("should not watch a datagram connection")
+	}
+}
@@ -0,0 +1,408 @@
+package srslog
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRejoinInterval is how often a pool Writer tries to reconnect to
+// ejected members, see WithRejoinInterval.
+const DefaultRejoinInterval = 30 * time.Second
+
+// poolReplicas is the number of points each member has on the hash ring.
+const poolReplicas = 64
+
+// Balance selects the member of a pool that a message is sent to. The zero
+// value is BalanceRoundRobin.
+type Balance struct {
+	mode balanceMode
+
+	// the structured data parameter hashed by BalanceHashSDParam
+	sdID, sdName string
+}
+
+type balanceMode int
+
+const (
+	balanceRoundRobin balanceMode = iota
+	balanceLeastInflight
+	balanceHashTag
+	balanceHashHostname
+	balanceHashSDParam
+)
+
+var (
+	// BalanceRoundRobin sends messages to the members in turn.
+	BalanceRoundRobin = Balance{mode: balanceRoundRobin}
+
+	// BalanceLeastInflight sends each message to the member with the
+	// fewest writes in progress.
+	BalanceLeastInflight = Balance{mode: balanceLeastInflight}
+
+	// BalanceHashTag sends all messages with the same tag to the same
+	// member, so they arrive in order.
+	BalanceHashTag = Balance{mode: balanceHashTag}
+
+	// BalanceHashHostname sends all messages with the same hostname to the
+	// same member, so they arrive in order.
+	BalanceHashHostname = Balance{mode: balanceHashHostname}
+)
+
+// BalanceHashSDParam sends all messages with the same value of the
+// structured data parameter name in element id to the same member, so they
+// arrive in order. Messages without the parameter are sent to the members
+// in turn.
+func BalanceHashSDParam(id, name string) Balance {
+	return Balance{mode: balanceHashSDParam, sdID: id, sdName: name}
+}
+
+// poolGroup is the state of a Writer created with DialPool. As with
+// failover, each endpoint has an unconnected member Writer that is only
+// used for its dialer.
+type poolGroup struct {
+	endpoints []Endpoint
+	members   []*Writer
+	balance   Balance
+	interval  time.Duration
+	ring      []ringPoint // sorted by hash
+
+	next atomic.Uint64 // round-robin counter
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// ringPoint places a member on the consistent hash ring.
+type ringPoint struct {
+	hash   uint32
+	member int
+}
+
+// WithRejoinInterval sets how often a Writer created with DialPool tries to
+// reconnect to the members it ejected after a failed write. It defaults to
+// DefaultRejoinInterval.
+func WithRejoinInterval(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.rejoinInterval = d
+		return nil
+	}
+}
+
+// DialPool establishes connections to all of endpoints and spreads messages
+// over them according to balance. It fails only if no endpoint can be
+// reached. A member whose write fails is ejected and the message is sent to
+// the next member instead; ejected members are reconnected in the
+// background and rejoin the pool once they accept a connection.
+//
+// With the hashing strategies a message only moves to another member while
+// its own member is ejected, and most keys stay where they are when a
+// member leaves or rejoins.
+func DialPool(endpoints []Endpoint, balance Balance, priority Priority, tag string, opts ...Option) (*Writer, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	opts = append(opts, func(w *Writer) error {
+		g := &poolGroup{
+			endpoints: append([]Endpoint(nil), endpoints...),
+			balance:   balance,
+			interval:  w.rejoinInterval,
+			stop:      make(chan struct{}),
+		}
+		if g.interval <= 0 {
+			g.interval = DefaultRejoinInterval
+		}
+		for _, e := range endpoints {
+			g.members = append(g.members, w.memberWriter(e))
+		}
+		g.ring = hashRing(endpoints)
+		w.pool = g
+		return nil
+	})
+
+	w, err := dialAllParameters(context.Background(), "pool", "", priority, tag, nil, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go w.rejoinPool()
+	return w, nil
+}
+
+// HealthyEndpoints returns the endpoints of a Writer created with DialPool
+// that messages are currently sent to, in the order they were given. It
+// returns nil for any other Writer.
+func (w *Writer) HealthyEndpoints() []Endpoint {
+	w = w.root()
+	pc, ok := w.getConn().(*poolConn)
+	if !ok {
+		return nil
+	}
+	var healthy []Endpoint
+	pc.mu.Lock()
+	for i, c := range pc.conns {
+		if c != nil {
+			healthy = append(healthy, pc.group.endpoints[i])
+		}
+	}
+	pc.mu.Unlock()
+	return healthy
+}
+
+// poolDialer connects to every member of the pool, and is used for Writers
+// created with DialPool.
+func (w *Writer) poolDialer(ctx context.Context) (serverConn, string, error) {
+	g := w.pool
+	if g == nil {
+		return nil, w.getHostname(), ErrNoEndpoints
+	}
+
+	pc := &poolConn{
+		group:    g,
+		conns:    make([]serverConn, len(g.members)),
+		inflight: make([]atomic.Int64, len(g.members)),
+	}
+	failed := &FailoverError{}
+	hostname := w.getHostname()
+	for i, m := range g.members {
+		sc, h, err := w.dialMember(ctx, m)
+		if err != nil {
+			failed.Errors = append(failed.Errors, err)
+			if contextErr(ctx) != nil {
+				break
+			}
+			continue
+		}
+		if pc.connected() == 0 {
+			hostname = h
+		}
+		pc.conns[i] = sc
+	}
+	if pc.connected() == 0 {
+		return nil, w.getHostname(), failed
+	}
+	return pc, hostname, nil
+}
+
+// rejoinPool periodically reconnects to ejected pool members and puts them
+// back into rotation.
+func (w *Writer) rejoinPool() {
+	g := w.pool
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+
+		pc, ok := w.getConn().(*poolConn)
+		if !ok {
+			continue
+		}
+		for i, m := range g.members {
+			if pc.member(i) != nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), g.interval)
+			sc, _, err := w.dialMember(ctx, m)
+			cancel()
+			if err == nil && !pc.rejoin(i, sc) {
+				sc.close()
+			}
+		}
+	}
+}
+
+// close stops the background reconnects.
+func (g *poolGroup) close() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// order returns the members to try for a message, best first. Ejected
+// members are skipped later, so every member is included.
+func (g *poolGroup) order(m *Message, inflight []atomic.Int64) []int {
+	n := len(g.members)
+	order := make([]int, 0, n)
+	mode := g.balance.mode
+	var key string
+	switch mode {
+	case balanceHashTag:
+		key = m.Tag
+	case balanceHashHostname:
+		key = m.Hostname
+	case balanceHashSDParam:
+		var ok bool
+		if key, ok = sdParam(m.StructuredData, g.balance.sdID, g.balance.sdName); !ok {
+			mode = balanceRoundRobin
+		}
+	}
+
+	switch mode {
+	case balanceHashTag, balanceHashHostname, balanceHashSDParam:
+		h := poolHash(key)
+		start := sort.Search(len(g.ring), func(i int) bool { return g.ring[i].hash >= h })
+		seen := make([]bool, n)
+		for i := 0; i < len(g.ring) && len(order) < n; i++ {
+			p := g.ring[(start+i)%len(g.ring)]
+			if !seen[p.member] {
+				seen[p.member] = true
+				order = append(order, p.member)
+			}
+		}
+	case balanceLeastInflight:
+		for i := 0; i < n; i++ {
+			order = append(order, i)
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return inflight[order[a]].Load() < inflight[order[b]].Load()
+		})
+	default:
+		start := int(g.next.Add(1) % uint64(n))
+		for i := 0; i < n; i++ {
+			order = append(order, (start+i)%n)
+		}
+	}
+	return order
+}
+
+// sdParam returns the value of parameter name in the first element of sd
+// with the given id.
+func sdParam(sd []SDElement, id, name string) (string, bool) {
+	for _, e := range sd {
+		if e.ID == id {
+			v, ok := e.Params[name]
+			return v, ok
+		}
+	}
+	return "", false
+}
+
+// hashRing places poolReplicas points for each endpoint on a consistent
+// hash ring.
+func hashRing(endpoints []Endpoint) []ringPoint {
+	var ring []ringPoint
+	for i, e := range endpoints {
+		for r := 0; r < poolReplicas; r++ {
+			ring = append(ring, ringPoint{poolHash(e.String() + "#" + strconv.Itoa(r)), i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+// poolHash hashes key for the ring. Like ketama it uses MD5, which spreads
+// short, similar keys far better than a cheap hash.
+func poolHash(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
+
+// poolConn is a serverConn that spreads writes over the connections to the
+// members of a pool. A nil connection is an ejected member.
+type poolConn struct {
+	group    *poolGroup
+	inflight []atomic.Int64
+
+	mu     sync.Mutex // guards conns and closed
+	conns  []serverConn
+	closed bool
+}
+
+func (pc *poolConn) member(i int) serverConn {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.conns[i]
+}
+
+func (pc *poolConn) connected() int {
+	n := 0
+	for _, c := range pc.conns {
+		if c != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// rejoin puts a new connection to member i into rotation. It returns false
+// if the member is already connected or the pool has been closed.
+func (pc *poolConn) rejoin(i int, sc serverConn) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.closed || pc.conns[i] != nil {
+		return false
+	}
+	pc.conns[i] = sc
+	return true
+}
+
+// eject takes member i out of rotation if conn is still its connection.
+func (pc *poolConn) eject(i int, conn serverConn) {
+	pc.mu.Lock()
+	current := pc.conns[i] == conn
+	if current {
+		pc.conns[i] = nil
+	}
+	pc.mu.Unlock()
+	if current {
+		conn.close()
+	}
+}
+
+// writeString sends the message to the first healthy member in the order
+// given by the pool's Balance, ejecting each member whose write fails. If
+// ctx is done, the member that was being written to is ejected, since the
+// message may have been partly sent, and no other member is tried.
+func (pc *poolConn) writeString(ctx context.Context, framer Framer, formatter MessageFormatter, m *Message) error {
+	failed := &FailoverError{}
+	for _, i := range pc.group.order(m, pc.inflight) {
+		conn := pc.member(i)
+		if conn == nil {
+			continue
+		}
+
+		pc.inflight[i].Add(1)
+		err := conn.writeString(ctx, framer, formatter, m)
+		pc.inflight[i].Add(-1)
+		if err == nil {
+			return nil
+		}
+
+		pc.eject(i, conn)
+		if ctxErr := contextErr(ctx); ctxErr != nil {
+			return ctxErr
+		}
+		failed.Errors = append(failed.Errors, err)
+	}
+	if len(failed.Errors) == 0 {
+		failed.Errors = append(failed.Errors, ErrNoEndpoints)
+	}
+	return failed
+}
+
+// close closes the connection to every member.
+func (pc *poolConn) close() error {
+	pc.mu.Lock()
+	conns := pc.conns
+	pc.conns = make([]serverConn, len(conns))
+	pc.closed = true
+	pc.mu.Unlock()
+
+	var err error
+	for _, c := range conns {
+		if c == nil {
+			continue
+		}
+		if cerr := c.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package srslog
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolRoundRobin(t *testing.T) {
+	a := startTestStreamServer(t, "127.0.0.1:0")
+	defer a.kill()
+	b := startTestStreamServer(t, "127.0.0.1:0")
+	defer b.kill()
+
+	endpoints := []Endpoint{{Network: "tcp", Addr: a.addr}, {Network: "tcp", Addr: b.addr}}
+	w, err := DialPool(endpoints, BalanceRoundRobin, LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("first")
+	w.Err("second")
+	select {
+	case <-a.msgs:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the first member received nothing")
+	}
+	select {
+	case <-b.msgs:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the second member received nothing")
+	}
+}
+
+func TestPoolEjectAndRejoin(t *testing.T) {
+	a := startTestStreamServer(t, "127.0.0.1:0")
+	b := startTestStreamServer(t, "127.0.0.1:0")
+	defer b.kill()
+
+	endpoints := []Endpoint{{Network: "tcp", Addr: a.addr}, {Network: "tcp", Addr: b.addr}}
+	w, err := DialPool(endpoints, BalanceRoundRobin, LOG_ERR, "tag", WithRejoinInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	if got := w.HealthyEndpoints(); len(got) != 2 {
+		t.Fatalf("expected both members to be healthy, got %v", got)
+	}
+
+	a.kill()
+	// Writes to the killed member may still be accepted by the kernel, so
+	// keep writing until it is ejected.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(w.HealthyEndpoints()) != 1 {
+		if err := w.Err("while ejecting"); err != nil {
+			t.Fatalf("writes should go to the remaining member, got %v", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("did not eject the failed member")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := w.HealthyEndpoints(); got[0] != endpoints[1] {
+		t.Errorf("expected the second member to remain, got %v", got)
+	}
+
+	a = startTestStreamServer(t, a.addr)
+	defer a.kill()
+	deadline = time.Now().Add(2 * time.Second)
+	for len(w.HealthyEndpoints()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the recovered member did not rejoin")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolHashKeepsKeysTogether(t *testing.T) {
+	endpoints := []Endpoint{{Network: "tcp", Addr: "a:514"}, {Network: "tcp", Addr: "b:514"}, {Network: "tcp", Addr: "c:514"}}
+	g := &poolGroup{balance: BalanceHashTag, members: make([]*Writer, 3), ring: hashRing(endpoints)}
+
+	used := map[int]bool{}
+	for _, tag := range []string{"api", "worker", "cron", "auth", "billing", "search"} {
+		first := g.order(&Message{Hostname: "host", Tag: tag}, nil)
+		for i := 0; i < 5; i++ {
+			if again := g.order(&Message{Hostname: "other-host", Tag: tag}, nil); again[0] != first[0] {
+				t.Fatalf("tag %q moved from member %d to %d", tag, first[0], again[0])
+			}
+		}
+		if len(first) != 3 {
+			t.Errorf("every member should be a candidate, got %v", first)
+		}
+		used[first[0]] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("tags should spread over the members, got %v", used)
+	}
+
+	g.balance = BalanceHashHostname
+	if g.order(&Message{Hostname: "host", Tag: "api"}, nil)[0] != g.order(&Message{Hostname: "host", Tag: "worker"}, nil)[0] {
+		t.Errorf("hashing on the hostname should ignore the tag")
+	}
+}
+
+func TestPoolHashSDParam(t *testing.T) {
+	endpoints := []Endpoint{{Network: "tcp", Addr: "a:514"}, {Network: "tcp", Addr: "b:514"}, {Network: "tcp", Addr: "c:514"}}
+	g := &poolGroup{balance: BalanceHashSDParam("req@32473", "user"), members: make([]*Writer, 3), ring: hashRing(endpoints)}
+	withUser := func(tag, user string) *Message {
+		return &Message{Tag: tag, StructuredData: []SDElement{
+			{ID: "other@32473", Params: map[string]string{"user": "ignored"}},
+			{ID: "req@32473", Params: map[string]string{"user": user, "path": tag}},
+		}}
+	}
+
+	used := map[int]bool{}
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		first := g.order(withUser("api", user), nil)
+		for _, tag := range []string{"worker", "cron", "auth"} {
+			if again := g.order(withUser(tag, user), nil); again[0] != first[0] {
+				t.Fatalf("user %q moved from member %d to %d", user, first[0], again[0])
+			}
+		}
+		used[first[0]] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("keys should spread over the members, got %v", used)
+	}
+
+	// messages without the parameter are sent in turn
+	if a, b := g.order(&Message{Tag: "api"}, nil), g.order(&Message{Tag: "api"}, nil); a[0] == b[0] {
+		t.Errorf("expected messages without the parameter to go to different members, got %v and %v", a, b)
+	}
+}
+
+func TestPoolLeastInflight(t *testing.T) {
+	g := &poolGroup{balance: BalanceLeastInflight, members: make([]*Writer, 3)}
+	inflight := make([]atomic.Int64, 3)
+	inflight[0].Store(4)
+	inflight[1].Store(2)
+	if order := g.order(&Message{}, inflight); order[0] != 2 || order[1] != 1 || order[2] != 0 {
+		t.Errorf("expected the least busy member first, got %v", order)
+	}
+}
+
+func TestPoolAllMembersDown(t *testing.T) {
+	endpoints := []Endpoint{{Network: "tcp", Addr: unusedAddr(t)}, {Network: "tcp", Addr: unusedAddr(t)}}
+	_, err := DialPool(endpoints, BalanceRoundRobin, LOG_ERR, "tag")
+	failed, ok := err.(*FailoverError)
+	if !ok {
+		t.Fatalf("expected a *FailoverError, got %v", err)
+	}
+	if len(failed.Errors) != 2 {
+		t.Errorf("expected an error per endpoint, got %v", failed.Errors)
+	}
+
+	if _, err := DialPool(nil, BalanceRoundRobin, LOG_ERR, "tag"); err != ErrNoEndpoints {
+		t.Errorf("expected ErrNoEndpoints, got %v", err)
+	}
+}
@@ -0,0 +1,368 @@
+package srslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrProxyUDP is returned when a Writer with a proxy dials a UDP network.
+// Proxies only tunnel TCP, so UDP messages would bypass the proxy.
+var ErrProxyUDP = errors.New("srslog: UDP cannot be sent through a proxy")
+
+// WithProxy makes TCP connections, including those of the "tcp+tls",
+// "relp" and "srv" networks, go through the proxy at proxyURL. The
+// supported schemes are "socks5", "socks5h" (the proxy resolves host
+// names), "http" and "https" (HTTP CONNECT). Credentials in the URL are
+// used to authenticate with the proxy. TLS to the collector runs through
+// the tunnel, end to end. Local networks are never proxied, and UDP fails
+// with ErrProxyUDP.
+func WithProxy(proxyURL string) Option {
+	return func(w *Writer) error {
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return err
+		}
+		w.proxy = u
+		return nil
+	}
+}
+
+// WithProxyFromEnvironment is like WithProxy, but takes the proxy from the
+// ALL_PROXY (or all_proxy) environment variable. Hosts listed in NO_PROXY
+// (or no_proxy) are connected to directly. Nothing is proxied if ALL_PROXY
+// is not set.
+func WithProxyFromEnvironment() Option {
+	return func(w *Writer) error {
+		proxyURL := getenvAny("ALL_PROXY", "all_proxy")
+		if proxyURL == "" {
+			return nil
+		}
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return err
+		}
+		w.proxy = u
+		w.noProxy = getenvAny("NO_PROXY", "no_proxy")
+		return nil
+	}
+}
+
+func getenvAny(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http", "https":
+	default:
+		return nil, fmt.Errorf("srslog: unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		port := "1080"
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// dialNet connects to addr on a network that may go through the Writer's
+// proxy.
+func (w *Writer) dialNet(ctx context.Context, network, addr string) (net.Conn, error) {
+	if w.proxy == nil || bypassProxy(w.noProxy, addr) {
+		return w.netDialer().DialContext(ctx, network, addr)
+	}
+	if strings.HasPrefix(network, "udp") {
+		return nil, ErrProxyUDP
+	}
+	if !proxyNetwork(network) {
+		return w.netDialer().DialContext(ctx, network, addr)
+	}
+
+	c, err := w.netDialer().DialContext(ctx, "tcp", w.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake with the proxy counts as part of dialing.
+	if w.dialTimeout > 0 {
+		c.SetDeadline(time.Now().Add(w.dialTimeout))
+	}
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if w.proxy.Scheme == "https" {
+		tc := tls.Client(c, &tls.Config{ServerName: w.proxy.Hostname()})
+		if err = tc.HandshakeContext(ctx); err == nil {
+			c = tc
+		}
+	}
+	if err == nil {
+		switch w.proxy.Scheme {
+		case "socks5", "socks5h":
+			err = socks5Connect(ctx, c, w.proxy, network, addr)
+		default:
+			var tunnel net.Conn
+			if tunnel, err = httpConnect(c, w.proxy, addr); err == nil {
+				c = tunnel
+			}
+		}
+	}
+	if err == nil && !stop() {
+		err = contextErr(ctx)
+	}
+	if err != nil {
+		c.Close()
+		if ctxErr := contextErr(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func proxyNetwork(network string) bool {
+	return network == "tcp" || network == "tcp4" || network == "tcp6"
+}
+
+// bypassProxy reports whether the host of addr matches noProxy, a comma
+// separated list of host names, domain suffixes and IP addresses, or "*".
+func bypassProxy(noProxy, addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	host = strings.ToLower(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || entry == host {
+			return true
+		}
+		if suffix := "." + strings.TrimPrefix(entry, "."); strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SOCKS5, RFC 1928, with username/password authentication, RFC 1929.
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+var socks5Replies = []string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect asks the SOCKS5 proxy on c to connect to addr. With the
+// "socks5" scheme host names are resolved locally, with "socks5h" by the
+// proxy.
+func socks5Connect(ctx context.Context, c net.Conn, proxy *url.URL, network, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 0xffff {
+		return fmt.Errorf("srslog: bad port in %q", addr)
+	}
+	if proxy.Scheme == "socks5" && net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return err
+		}
+		host = ips[0].String()
+		if network == "tcp4" {
+			for _, ip := range ips {
+				if ip.To4() != nil {
+					host = ip.String()
+					break
+				}
+			}
+		}
+	}
+
+	methods := []byte{socks5AuthNone}
+	if proxy.User != nil {
+		methods = []byte{socks5AuthNone, socks5AuthPassword}
+	}
+	if _, err := c.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(c, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return errors.New("srslog: proxy is not a SOCKS5 server")
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if proxy.User == nil {
+			return errors.New("srslog: SOCKS5 proxy requires authentication")
+		}
+		if err := socks5Authenticate(c, proxy.User); err != nil {
+			return err
+		}
+	case socks5NoAcceptable:
+		return errors.New("srslog: SOCKS5 proxy accepted none of the authentication methods")
+	default:
+		return fmt.Errorf("srslog: SOCKS5 proxy chose unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, socks5AddrIPv4), ip4...)
+		} else {
+			req = append(append(req, socks5AddrIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("srslog: host name too long for SOCKS5: %q", host)
+		}
+		req = append(append(req, socks5AddrDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(c, head[:]); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		reason := "unknown error"
+		if int(head[1]) < len(socks5Replies) {
+			reason = socks5Replies[head[1]]
+		}
+		return fmt.Errorf("srslog: SOCKS5 proxy could not connect to %s: %s", addr, reason)
+	}
+	// Skip the bound address and port.
+	var skip int
+	switch head[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len + 2
+	case socks5AddrIPv6:
+		skip = net.IPv6len + 2
+	case socks5AddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0]) + 2
+	default:
+		return fmt.Errorf("srslog: SOCKS5 proxy sent unknown address type %d", head[3])
+	}
+	_, err = io.ReadFull(c, make([]byte, skip))
+	return err
+}
+
+func socks5Authenticate(c net.Conn, user *url.Userinfo) error {
+	name := user.Username()
+	password, _ := user.Password()
+	if len(name) > 255 || len(password) > 255 {
+		return errors.New("srslog: SOCKS5 username or password too long")
+	}
+	req := append([]byte{0x01, byte(len(name))}, name...)
+	req = append(append(req, byte(len(password))), password...)
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(c, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("srslog: SOCKS5 proxy authentication failed")
+	}
+	return nil
+}
+
+// httpConnect opens a tunnel to addr with an HTTP CONNECT request. The
+// returned connection reads anything the proxy sent after its response.
+func httpConnect(c net.Conn, proxy *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("srslog: proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: c, r: br}, nil
+	}
+	return c, nil
+}
+
+// bufferedConn is a net.Conn whose reads start with data already buffered.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
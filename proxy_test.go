@@ -0,0 +1,328 @@
+package srslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProxy is a SOCKS5 or HTTP CONNECT proxy that records the addresses
+// it was asked to connect to.
+type testProxy struct {
+	l net.Listener
+
+	mu      sync.Mutex
+	targets []string
+}
+
+func (p *testProxy) target() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return ""
+	}
+	return p.targets[len(p.targets)-1]
+}
+
+// startTestProxy starts a proxy for scheme "socks5" or "http". If user is
+// set, clients must authenticate as user with password.
+func startTestProxy(t *testing.T, scheme, user, password string) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	p := &testProxy{l: l}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				var target string
+				var in io.Reader
+				if scheme == "socks5" {
+					target = socks5Handshake(c, user, password)
+					in = c
+				} else {
+					br := bufio.NewReader(c)
+					target = connectHandshake(c, br, user, password)
+					in = br
+				}
+				if target == "" {
+					c.Close()
+					return
+				}
+				p.mu.Lock()
+				p.targets = append(p.targets, target)
+				p.mu.Unlock()
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					c.Close()
+					return
+				}
+				go func() {
+					io.Copy(c, upstream)
+					c.Close()
+				}()
+				io.Copy(upstream, in)
+				upstream.Close()
+			}(c)
+		}
+	}()
+	return p
+}
+
+// socks5Handshake runs the server side of a SOCKS5 CONNECT and returns the
+// target, or "" if the client was refused.
+func socks5Handshake(c net.Conn, user, password string) string {
+	var head [2]byte
+	if _, err := io.ReadFull(c, head[:]); err != nil {
+		return ""
+	}
+	methods := make([]byte, head[1])
+	io.ReadFull(c, methods)
+
+	if user == "" {
+		c.Write([]byte{5, 0})
+	} else {
+		c.Write([]byte{5, 2})
+		var ver [2]byte
+		io.ReadFull(c, ver[:])
+		name := make([]byte, ver[1])
+		io.ReadFull(c, name)
+		var n [1]byte
+		io.ReadFull(c, n[:])
+		pass := make([]byte, n[0])
+		io.ReadFull(c, pass)
+		if string(name) != user || string(pass) != password {
+			c.Write([]byte{1, 1})
+			return ""
+		}
+		c.Write([]byte{1, 0})
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(c, req[:]); err != nil {
+		return ""
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(c, ip)
+		host = net.IP(ip).String()
+	case 3:
+		var n [1]byte
+		io.ReadFull(c, n[:])
+		name := make([]byte, n[0])
+		io.ReadFull(c, name)
+		host = string(name)
+	default:
+		return ""
+	}
+	var port [2]byte
+	io.ReadFull(c, port[:])
+	c.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+}
+
+// connectHandshake reads an HTTP CONNECT request and returns its target,
+// or "" if the client was refused.
+func connectHandshake(c net.Conn, br *bufio.Reader, user, password string) string {
+	req, err := http.ReadRequest(br)
+	if err != nil || req.Method != http.MethodConnect {
+		return ""
+	}
+	if user != "" {
+		r := &http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}
+		u, p, ok := r.BasicAuth()
+		if !ok || u != user || p != password {
+			io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+			return ""
+		}
+	}
+	io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+	p := startTestProxy(t, "socks5", "user", "secret")
+	defer p.l.Close()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithProxy("socks5://user:secret@"+p.l.Addr().String()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.Err("through socks")
+	s.receive(t, "through socks")
+	if p.target() != s.addr {
+		t.Errorf("expected the proxy to connect to %s, got %q", s.addr, p.target())
+	}
+
+	if _, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithProxy("socks5://user:wrong@"+p.l.Addr().String())); err == nil {
+		t.Errorf("should fail with the wrong password")
+	}
+}
+
+func TestSOCKS5hProxyResolvesRemotely(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+	p := startTestProxy(t, "socks5", "", "")
+	defer p.l.Close()
+
+	_, port, _ := net.SplitHostPort(s.addr)
+	w, err := DialWithOptions("tcp", net.JoinHostPort("localhost", port), LOG_ERR, "tag", WithProxy("socks5h://"+p.l.Addr().String()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	if p.target() != net.JoinHostPort("localhost", port) {
+		t.Errorf("expected the proxy to receive the host name, got %q", p.target())
+	}
+}
+
+func TestHTTPConnectProxy(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+	p := startTestProxy(t, "http", "user", "secret")
+	defer p.l.Close()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithProxy("http://user:secret@"+p.l.Addr().String()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.Err("through connect")
+	s.receive(t, "through connect")
+
+	if _, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithProxy("http://"+p.l.Addr().String())); err == nil {
+		t.Errorf("should fail without credentials")
+	}
+}
+
+func TestTLSThroughProxy(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		line, _ := bufio.NewReader(c).ReadString('\n')
+		received <- line
+	}()
+
+	p := startTestProxy(t, "http", "", "")
+	defer p.l.Close()
+	w, err := DialWithOptions("tcp+tls", l.Addr().String(), LOG_ERR, "tag",
+		WithTLSConfig(clientConfig), WithProxy("http://"+p.l.Addr().String()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.Err("end to end")
+
+	select {
+	case line := <-received:
+		checkWithPriorityAndTag(t, LOG_ERR, "tag", w.hostname, "end to end", line)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the message")
+	}
+}
+
+func TestProxyUDPAndNoProxy(t *testing.T) {
+	if _, err := DialWithOptions("udp", "127.0.0.1:514", LOG_ERR, "tag", WithProxy("socks5://127.0.0.1:1")); err != ErrProxyUDP {
+		t.Errorf("expected ErrProxyUDP, got %v", err)
+	}
+	if _, err := DialWithOptions("tcp", "127.0.0.1:514", LOG_ERR, "tag", WithProxy("ftp://127.0.0.1")); err == nil {
+		t.Errorf("should reject an unsupported proxy scheme")
+	}
+
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+	t.Setenv("ALL_PROXY", "socks5://"+unusedAddr(t))
+	t.Setenv("NO_PROXY", "localhost,127.0.0.1")
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithProxyFromEnvironment())
+	if err != nil {
+		t.Fatalf("should connect directly to a host in NO_PROXY: %v", err)
+	}
+	w.Close()
+
+	t.Setenv("NO_PROXY", "")
+	if _, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithProxyFromEnvironment()); err == nil {
+		t.Errorf("should go through the unreachable proxy from ALL_PROXY")
+	}
+}
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		noProxy, addr string
+		bypass        bool
+	}{
+		{"", "example.com:514", false},
+		{"*", "example.com:514", true},
+		{"example.com", "example.com:514", true},
+		{"example.com", "logs.example.com:514", true},
+		{".example.com", "logs.example.com:514", true},
+		{"example.com", "notexample.com:514", false},
+		{"10.0.0.1, other.org", "10.0.0.1:514", true},
+	}
+	for _, test := range tests {
+		if got := bypassProxy(test.noProxy, test.addr); got != test.bypass {
+			t.Errorf("bypassProxy(%q, %q) = %v, expected %v", test.noProxy, test.addr, got, test.bypass)
+		}
+	}
+}
+
+// testTLSConfigs returns a server configuration with a self-signed
+// certificate for 127.0.0.1 and a client configuration that trusts it.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
@@ -0,0 +1,243 @@
+package srslog
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSuppressedSummaryInterval is how often a Writer reports messages
+// it dropped because of rate limits and sampling, see
+// WithSuppressedSummaryInterval.
+const DefaultSuppressedSummaryInterval = time.Minute
+
+// RateLimit is a token bucket: it lets through Rate messages per second on
+// average, and bursts of up to Burst messages.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Sampling decides which messages a sampled severity keeps, see
+// WithSampling.
+type Sampling int
+
+const (
+	// SampleRandom keeps each message with the sampling rate as its
+	// probability.
+	SampleRandom Sampling = iota
+
+	// SampleHash keeps a message if a hash of its content falls below the
+	// sampling rate, so a given message is either always kept or always
+	// dropped.
+	SampleHash
+)
+
+// WithSeverityRateLimit limits messages of the given severity.
+func WithSeverityRateLimit(severity Priority, limit RateLimit) Option {
+	return func(w *Writer) error {
+		l := w.rateLimiter()
+		l.severities[severity&severityMask] = newTokenBucket(limit)
+		return nil
+	}
+}
+
+// WithFacilityRateLimit limits messages of the given facility.
+func WithFacilityRateLimit(facility Priority, limit RateLimit) Option {
+	return func(w *Writer) error {
+		l := w.rateLimiter()
+		l.facilities[facility&facilityMask] = newTokenBucket(limit)
+		return nil
+	}
+}
+
+// WithTagRateLimit limits messages with the given tag.
+func WithTagRateLimit(tag string, limit RateLimit) Option {
+	return func(w *Writer) error {
+		l := w.rateLimiter()
+		l.tags[tag] = newTokenBucket(limit)
+		return nil
+	}
+}
+
+// WithSampling keeps only the given fraction, between 0 and 1, of the
+// messages of a severity. It is meant for LOG_DEBUG and LOG_INFO.
+func WithSampling(severity Priority, rate float64, mode Sampling) Option {
+	return func(w *Writer) error {
+		l := w.rateLimiter()
+		l.samplers[severity&severityMask] = sampler{rate: rate, mode: mode}
+		return nil
+	}
+}
+
+// WithSuppressedSummaryInterval sets how often a Writer with rate limits or
+// sampling sends a LOG_WARNING summary of the messages it dropped, if it
+// dropped any. It defaults to DefaultSuppressedSummaryInterval.
+func WithSuppressedSummaryInterval(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.rateLimiter().interval = d
+		return nil
+	}
+}
+
+// Suppressed returns the number of messages a Writer has dropped because of
+// rate limits and sampling.
+func (w *Writer) Suppressed() uint64 {
+	w = w.root()
+	if w.limiter == nil {
+		return 0
+	}
+	return w.limiter.suppressed.Load()
+}
+
+// rateLimiter returns the Writer's rate limiter, creating it if needed.
+func (w *Writer) rateLimiter() *rateLimiter {
+	if w.limiter == nil {
+		w.limiter = &rateLimiter{
+			severities: make(map[Priority]*tokenBucket),
+			facilities: make(map[Priority]*tokenBucket),
+			tags:       make(map[string]*tokenBucket),
+			samplers:   make(map[Priority]sampler),
+			interval:   DefaultSuppressedSummaryInterval,
+		}
+	}
+	return w.limiter
+}
+
+// tokenBucket implements a RateLimit. It is guarded by the mutex of its
+// rateLimiter.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst}
+}
+
+// refill adds the tokens earned since the last call and reports whether
+// one is available.
+func (b *tokenBucket) refill(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	return b.tokens >= 1
+}
+
+type sampler struct {
+	rate float64
+	mode Sampling
+}
+
+func (s sampler) keep(msg string) bool {
+	if s.mode == SampleHash {
+		h := fnv.New32a()
+		h.Write([]byte(strings.TrimSuffix(msg, "\n")))
+		return float64(h.Sum32()) < s.rate*(1<<32)
+	}
+	return rand.Float64() < s.rate
+}
+
+// rateLimiter applies the rate limits and sampling of a Writer.
+type rateLimiter struct {
+	samplers   map[Priority]sampler
+	interval   time.Duration
+	suppressed atomic.Uint64
+
+	mu         sync.Mutex
+	severities map[Priority]*tokenBucket
+	facilities map[Priority]*tokenBucket
+	tags       map[string]*tokenBucket
+	limited    int         // dropped by rate limits since the last summary
+	sampled    int         // dropped by sampling since the last summary
+	summary    *time.Timer // set while a summary is scheduled
+	closed     bool
+}
+
+// allowRate reports whether a message passes the sampling and rate limits of
+// the Writer, and counts it if not. A message takes a token from each
+// bucket that applies only if all of them have one.
+func (w *Writer) allowRate(p Priority, tag, msg string) bool {
+	l := w.limiter
+	if s, ok := l.samplers[p&severityMask]; ok && !s.keep(msg) {
+		l.suppress(w, false)
+		return false
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	buckets := make([]*tokenBucket, 0, 3)
+	for _, b := range []*tokenBucket{l.severities[p&severityMask], l.facilities[p&facilityMask], l.tags[tag]} {
+		if b == nil {
+			continue
+		}
+		if !b.refill(now) {
+			l.mu.Unlock()
+			l.suppress(w, true)
+			return false
+		}
+		buckets = append(buckets, b)
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	l.mu.Unlock()
+	return true
+}
+
+// suppress counts a dropped message and schedules a summary.
+func (l *rateLimiter) suppress(w *Writer, limited bool) {
+	l.suppressed.Add(1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limited {
+		l.limited++
+	} else {
+		l.sampled++
+	}
+	if l.summary == nil && !l.closed && l.interval > 0 {
+		l.summary = time.AfterFunc(l.interval, w.sendSuppressedSummary)
+	}
+}
+
+// sendSuppressedSummary sends a summary of the messages dropped since the
+// last one.
+func (w *Writer) sendSuppressedSummary() {
+	l := w.limiter
+	l.mu.Lock()
+	limited, sampled := l.limited, l.sampled
+	l.limited, l.sampled = 0, 0
+	if l.summary != nil {
+		l.summary.Stop()
+		l.summary = nil
+	}
+	l.mu.Unlock()
+	if limited == 0 && sampled == 0 {
+		return
+	}
+
+	p := (w.priority & facilityMask) | LOG_WARNING
+	msg := fmt.Sprintf("suppressed %d messages: %d rate limited, %d sampled out", limited+sampled, limited, sampled)
+	w.dispatch(context.Background(), Message{Priority: p, Content: msg})
+}
+
+// closeRateLimiter sends the last summary, if any.
+func (w *Writer) closeRateLimiter() {
+	w.limiter.mu.Lock()
+	w.limiter.closed = true
+	w.limiter.mu.Unlock()
+	w.sendSuppressedSummary()
+}
@@ -0,0 +1,127 @@
+package srslog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if !b.refill(now) {
+			t.Fatalf("expected the burst to be available")
+		}
+		b.tokens--
+	}
+	if b.refill(now) {
+		t.Errorf("expected the bucket to be empty")
+	}
+	if !b.refill(now.Add(100 * time.Millisecond)) {
+		t.Errorf("expected a token after 100ms at 10/s")
+	}
+	if b.refill(now.Add(time.Hour)); b.tokens != 2 {
+		t.Errorf("expected the tokens to be capped at the burst, got %v", b.tokens)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR|LOG_LOCAL0, "tag",
+		WithSeverityRateLimit(LOG_INFO, RateLimit{Rate: 0.001, Burst: 3}),
+		WithFacilityRateLimit(LOG_LOCAL1, RateLimit{Rate: 0.001, Burst: 1}),
+		WithSuppressedSummaryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := w.Info(fmt.Sprintf("info %d", i)); err != nil {
+			t.Fatalf("dropped messages should not fail: %v", err)
+		}
+	}
+	w.Err("not limited")
+	w.WriteWithPriority(LOG_ERR|LOG_LOCAL1, []byte("local1 0"))
+	w.WriteWithPriority(LOG_ERR|LOG_LOCAL1, []byte("local1 1"))
+
+	s.receiveNext(t, "info 0")
+	s.receiveNext(t, "info 1")
+	s.receiveNext(t, "info 2")
+	s.receiveNext(t, "not limited")
+	s.receiveNext(t, "local1 0")
+	if n := w.Suppressed(); n != 8 {
+		t.Errorf("expected 8 suppressed messages, got %d", n)
+	}
+	s.receiveNext(t, "suppressed 8 messages: 8 rate limited, 0 sampled out")
+}
+
+func TestTagRateLimit(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "noisy",
+		WithTagRateLimit("noisy", RateLimit{Rate: 0.001, Burst: 1}),
+		WithTagRateLimit("other", RateLimit{Rate: 0.001, Burst: 0}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	w.Err("first")
+	w.Err("second")
+	if n := w.Suppressed(); n != 1 {
+		t.Errorf("expected 1 suppressed message, got %d", n)
+	}
+
+	// Close sends the summary.
+	w.Close()
+	s.receiveNext(t, "first")
+	s.receiveNext(t, "suppressed 1 messages: 1 rate limited, 0 sampled out")
+}
+
+func TestSampling(t *testing.T) {
+	s := sampler{rate: 0.5, mode: SampleHash}
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		keep := s.keep(msg)
+		for i := 0; i < 10; i++ {
+			if s.keep(msg+"\n") != keep {
+				t.Fatalf("hash sampling should always decide the same for %q", msg)
+			}
+		}
+	}
+
+	kept := 0
+	s = sampler{rate: 0.5, mode: SampleHash}
+	for i := 0; i < 1000; i++ {
+		if s.keep(fmt.Sprintf("message %d", i)) {
+			kept++
+		}
+	}
+	if kept < 400 || kept > 600 {
+		t.Errorf("expected about half the messages to be kept, got %d", kept)
+	}
+
+	for _, mode := range []Sampling{SampleRandom, SampleHash} {
+		if (sampler{rate: 0, mode: mode}).keep("x") || !(sampler{rate: 1, mode: mode}).keep("x") {
+			t.Errorf("mode %d: rates 0 and 1 should drop and keep everything", mode)
+		}
+	}
+}
+
+func TestSamplingWriter(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag",
+		WithSampling(LOG_DEBUG, 0, SampleRandom))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	w.Debug("sampled out")
+	w.Info("kept")
+	w.Close()
+	s.receiveNext(t, "kept")
+	s.receiveNext(t, "suppressed 1 messages: 0 rate limited, 1 sampled out")
+}
@@ -0,0 +1,474 @@
+package srslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRELPWindow is the number of RELP messages that may be sent
+// without being acknowledged before writes block. It matches the default
+// window of rsyslog's omrelp.
+const DefaultRELPWindow = 128
+
+// relpAckTimeout bounds how long a write waits for room in the window, and
+// how long a graceful close waits for outstanding acknowledgements, on
+// Writers without a write timeout.
+var relpAckTimeout = 30 * time.Second
+
+var errRELPAckTimeout = errors.New("srslog: timed out waiting for RELP acknowledgement")
+
+// relpOffers are the offers sent with the RELP open command.
+const relpOffers = "relp_version=0\nrelp_software=srslog\ncommands=syslog"
+
+var errRELPClosed = errors.New("srslog: RELP connection closed")
+
+// relpMaxDataLen is the largest DATALEN accepted from the server. Responses
+// are short; anything larger is a protocol error, as in librelp, which
+// limits frames to 128 KiB by default.
+const relpMaxDataLen = 128 * 1024
+
+// relpMaxTxnr is the largest RELP transaction number. Transaction numbers
+// have at most 9 digits and wrap from relpMaxTxnr to 1.
+const relpMaxTxnr = 999999999
+
+// relpMaxCommandLen is the longest RELP command name, per the RELP
+// specification.
+const relpMaxCommandLen = 32
+
+// relpSession is the part of the RELP state that outlives a single
+// connection: messages that were sent but never acknowledged are carried
+// over and resent once the Writer reconnects, which gives at-least-once
+// delivery.
+type relpSession struct {
+	mu      sync.Mutex
+	unacked []string
+}
+
+// take removes and returns the carried-over messages.
+func (s *relpSession) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.unacked
+	s.unacked = nil
+	return msgs
+}
+
+// keep stores unacknowledged messages, ahead of any already carried over.
+func (s *relpSession) keep(msgs []string) {
+	if len(msgs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.unacked = append(msgs, s.unacked...)
+	s.mu.Unlock()
+}
+
+// relpConn adheres to the serverConn interface and sends syslog messages
+// using the Reliable Event Logging Protocol. Every message is a numbered
+// transaction that the server acknowledges; up to window transactions may
+// be outstanding at once.
+type relpConn struct {
+	conn         net.Conn
+	session      *relpSession
+	writeTimeout time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	window  int
+	txnr    int
+	pending map[int]string // unacknowledged messages by transaction number
+	acks    map[int]chan relpResponse
+	err     error // set once the connection is unusable
+	stalled bool  // set once a wait for acknowledgements timed out
+
+	done chan struct{} // closed when the reader exits
+}
+
+// relpResponse is the status of a rsp frame, e.g. 200 "OK".
+type relpResponse struct {
+	code int
+	text string
+}
+
+// newRELPConn performs the RELP open handshake on c, waiting up to
+// openTimeout for the server's response, resends anything the session
+// carried over from a previous connection and starts reading
+// acknowledgements.
+func newRELPConn(ctx context.Context, c net.Conn, session *relpSession, window int, writeTimeout, openTimeout time.Duration) (*relpConn, error) {
+	if window < 1 {
+		window = DefaultRELPWindow
+	}
+	rc := &relpConn{
+		conn:         c,
+		session:      session,
+		writeTimeout: writeTimeout,
+		window:       window,
+		pending:      make(map[int]string),
+		acks:         make(map[int]chan relpResponse),
+		done:         make(chan struct{}),
+	}
+	rc.cond = sync.NewCond(&rc.mu)
+	go rc.readLoop(bufio.NewReader(c))
+
+	open, err := rc.command("open", relpOffers)
+	if err == nil {
+		err = waitRELPResponse(ctx, open, openTimeout)
+	}
+	if err != nil {
+		rc.conn.Close()
+		return nil, err
+	}
+
+	carried := session.take()
+	for i, msg := range carried {
+		if err := rc.send(ctx, msg); err != nil {
+			rc.conn.Close()
+			session.keep(carried[i:])
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// writeString formats a syslog message and sends it as a RELP syslog
+// transaction. The framer is not used; RELP frames carry their own length.
+// It returns once the message is written, not once it is acknowledged,
+// unless the window is full.
+func (r *relpConn) writeString(ctx context.Context, framer Framer, formatter MessageFormatter, m *Message) error {
+	if formatter == nil {
+		formatter = DefaultMessageFormatter
+	}
+	return r.send(ctx, strings.TrimSuffix(formatter(m), "\n"))
+}
+
+// send waits for room in the window and sends msg. If the write fails, the
+// message is not kept for resending; the caller gets the error instead.
+func (r *relpConn) send(ctx context.Context, msg string) error {
+	r.mu.Lock()
+	if err := r.waitLocked(ctx, func() bool { return len(r.pending) < r.window }); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	txnr := r.nextTxnrLocked()
+	r.pending[txnr] = msg
+	err := r.writeFrameLocked(ctx, txnr, "syslog", msg)
+	if err != nil {
+		delete(r.pending, txnr)
+		r.failLocked(err)
+	}
+	r.mu.Unlock()
+	return err
+}
+
+// command sends a command other than syslog and returns a channel that
+// receives its response.
+func (r *relpConn) command(cmd, data string) (<-chan relpResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	txnr := r.nextTxnrLocked()
+	ch := make(chan relpResponse, 1)
+	r.acks[txnr] = ch
+	if err := r.writeFrameLocked(context.Background(), txnr, cmd, data); err != nil {
+		r.failLocked(err)
+		return nil, err
+	}
+	return ch, nil
+}
+
+// nextTxnrLocked returns the next transaction number, wrapping after
+// relpMaxTxnr like librelp.
+func (r *relpConn) nextTxnrLocked() int {
+	r.txnr = r.txnr%relpMaxTxnr + 1
+	return r.txnr
+}
+
+// unackedLocked returns the unacknowledged messages, oldest first.
+func (r *relpConn) unackedLocked() []string {
+	txnrs := make([]int, 0, len(r.pending))
+	for txnr := range r.pending {
+		txnrs = append(txnrs, txnr)
+	}
+	// Older transactions are further behind the last one, counting
+	// across the wrap.
+	age := func(txnr int) int { return (r.txnr - txnr + relpMaxTxnr) % relpMaxTxnr }
+	sort.Slice(txnrs, func(i, j int) bool { return age(txnrs[i]) > age(txnrs[j]) })
+	unacked := make([]string, len(txnrs))
+	for i, txnr := range txnrs {
+		unacked[i] = r.pending[txnr]
+	}
+	return unacked
+}
+
+// waitRELPResponse waits up to timeout for a command response and checks
+// its status.
+func waitRELPResponse(ctx context.Context, ch <-chan relpResponse, timeout time.Duration) error {
+	select {
+	case rsp, ok := <-ch:
+		if !ok {
+			return errRELPClosed
+		}
+		if rsp.code != 200 {
+			return fmt.Errorf("srslog: RELP server replied %d %s", rsp.code, rsp.text)
+		}
+		return nil
+	case <-time.After(timeout):
+		return errors.New("srslog: timed out waiting for RELP response")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeFrameLocked writes a single RELP frame. r.mu must be held so that
+// frames from concurrent writers are not interleaved.
+func (r *relpConn) writeFrameLocked(ctx context.Context, txnr int, cmd, data string) error {
+	if r.err != nil {
+		return r.err
+	}
+	var frame string
+	if data == "" {
+		frame = fmt.Sprintf("%d %s 0\n", txnr, cmd)
+	} else {
+		frame = fmt.Sprintf("%d %s %d %s\n", txnr, cmd, len(data), data)
+	}
+	defer setWriteDeadline(ctx, r.conn, r.writeTimeout)()
+	_, err := io.WriteString(r.conn, frame)
+	return err
+}
+
+// ackTimeout returns how long to wait for acknowledgements: the write
+// timeout, or relpAckTimeout without one.
+func (r *relpConn) ackTimeout() time.Duration {
+	if r.writeTimeout > 0 {
+		return r.writeTimeout
+	}
+	return relpAckTimeout
+}
+
+// waitLocked waits until ready returns true, the connection fails, ctx is
+// done or the ack timeout passes. r.mu must be held.
+func (r *relpConn) waitLocked(ctx context.Context, ready func() bool) error {
+	timedOut := false
+	timer := time.AfterFunc(r.ackTimeout(), func() {
+		r.mu.Lock()
+		timedOut = true
+		r.cond.Broadcast()
+		r.mu.Unlock()
+	})
+	defer timer.Stop()
+	stop := context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		r.cond.Broadcast()
+		r.mu.Unlock()
+	})
+	defer stop()
+
+	for r.err == nil && !ready() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if timedOut {
+			r.stalled = true
+			return errRELPAckTimeout
+		}
+		r.cond.Wait()
+	}
+	return r.err
+}
+
+// failLocked marks the connection as unusable and wakes up every waiter.
+// r.mu must be held.
+func (r *relpConn) failLocked(err error) {
+	if r.err == nil {
+		r.err = err
+		r.conn.Close()
+	}
+	r.cond.Broadcast()
+}
+
+// readLoop processes responses from the server until the connection
+// fails.
+func (r *relpConn) readLoop(br *bufio.Reader) {
+	defer close(r.done)
+	for {
+		txnr, cmd, data, err := readRELPFrame(br)
+		if err == nil && cmd == "serverclose" {
+			err = errRELPClosed
+		}
+		if err == nil && cmd != "rsp" {
+			err = fmt.Errorf("srslog: unexpected RELP command %q", cmd)
+		}
+		if err != nil {
+			r.mu.Lock()
+			r.failLocked(err)
+			for txnr, ch := range r.acks {
+				close(ch)
+				delete(r.acks, txnr)
+			}
+			r.mu.Unlock()
+			return
+		}
+
+		rsp := parseRELPResponse(data)
+		r.mu.Lock()
+		if ch, ok := r.acks[txnr]; ok {
+			ch <- rsp
+			delete(r.acks, txnr)
+		} else if _, ok := r.pending[txnr]; ok {
+			if rsp.code == 200 {
+				delete(r.pending, txnr)
+			} else {
+				// Keep the message so it is resent on the next connection.
+				r.failLocked(fmt.Errorf("srslog: RELP server replied %d %s", rsp.code, rsp.text))
+			}
+		}
+		r.cond.Broadcast()
+		r.mu.Unlock()
+	}
+}
+
+// healthy reports whether the connection is still usable.
+func (r *relpConn) healthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err == nil
+}
+
+// setWindow changes the number of unacknowledged messages allowed.
+func (r *relpConn) setWindow(window int) {
+	r.mu.Lock()
+	r.window = window
+	r.cond.Broadcast()
+	r.mu.Unlock()
+}
+
+// close waits for outstanding acknowledgements and closes the session
+// gracefully if the connection is still healthy. A server that already
+// let a write time out waiting for acknowledgements is not waited for
+// again. Whatever is still unacknowledged is handed to the session for the
+// next connection.
+func (r *relpConn) close() error {
+	r.mu.Lock()
+	if !r.stalled {
+		r.waitLocked(context.Background(), func() bool { return len(r.pending) == 0 })
+	}
+	healthy := r.err == nil && !r.stalled
+	r.mu.Unlock()
+
+	if healthy {
+		if ch, err := r.command("close", ""); err == nil {
+			waitRELPResponse(context.Background(), ch, r.ackTimeout())
+		}
+	}
+
+	r.mu.Lock()
+	r.failLocked(errRELPClosed)
+	r.mu.Unlock()
+	<-r.done
+
+	r.mu.Lock()
+	unacked := r.unackedLocked()
+	r.pending = make(map[int]string)
+	r.mu.Unlock()
+
+	r.session.keep(unacked)
+	return nil
+}
+
+// readRELPFrame reads "TXNR SP COMMAND SP DATALEN [SP DATA] LF".
+func readRELPFrame(r *bufio.Reader) (txnr int, cmd string, data []byte, err error) {
+	// field reads up to max bytes followed by a space.
+	field := func(name string, max int) (string, error) {
+		var b []byte
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			if c == ' ' {
+				return string(b), nil
+			}
+			if len(b) == max {
+				return "", fmt.Errorf("srslog: invalid RELP %s %q", name, b)
+			}
+			b = append(b, c)
+		}
+	}
+
+	s, err := field("transaction number", 9)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if txnr, err = strconv.Atoi(s); err != nil {
+		return 0, "", nil, fmt.Errorf("srslog: invalid RELP transaction number %q", s)
+	}
+	if cmd, err = field("command", relpMaxCommandLen); err != nil {
+		return 0, "", nil, err
+	}
+
+	// DATALEN is followed by a space if there is data, or by the trailer.
+	var lenBuf []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, "", nil, err
+		}
+		if c == ' ' || c == '\n' {
+			n, err := strconv.Atoi(string(lenBuf))
+			if err != nil || n < 0 || n > relpMaxDataLen {
+				return 0, "", nil, fmt.Errorf("srslog: invalid RELP data length %q", lenBuf)
+			}
+			if c == '\n' {
+				if n != 0 {
+					return 0, "", nil, fmt.Errorf("srslog: missing RELP data")
+				}
+				return txnr, cmd, nil, nil
+			}
+			data = make([]byte, n)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return 0, "", nil, err
+			}
+			break
+		}
+		// DATALEN has at most 9 digits.
+		if len(lenBuf) == 9 {
+			return 0, "", nil, fmt.Errorf("srslog: invalid RELP data length %q", lenBuf)
+		}
+		lenBuf = append(lenBuf, c)
+	}
+
+	if c, err := r.ReadByte(); err != nil {
+		return 0, "", nil, err
+	} else if c != '\n' {
+		return 0, "", nil, fmt.Errorf("srslog: invalid RELP frame trailer %q", c)
+	}
+	return txnr, cmd, data, nil
+}
+
+// parseRELPResponse parses the data of a rsp frame: a three digit code, a
+// human readable text and optionally further lines, such as offers.
+func parseRELPResponse(data []byte) relpResponse {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	fields := strings.SplitN(string(line), " ", 2)
+	code, _ := strconv.Atoi(fields[0])
+	rsp := relpResponse{code: code}
+	if len(fields) > 1 {
+		rsp.text = fields[1]
+	}
+	return rsp
+}
@@ -0,0 +1,364 @@
+package srslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// relpTestServer is a minimal RELP server. It acknowledges syslog
+// transactions immediately unless holdAcks is set, in which case they are
+// acknowledged by release.
+type relpTestServer struct {
+	l    net.Listener
+	msgs chan string
+
+	mu       sync.Mutex
+	holdAcks bool
+	held     map[net.Conn][]int
+	cmds     []string
+}
+
+func startRELPServer(t *testing.T) *relpTestServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &relpTestServer{
+		l:    l,
+		msgs: make(chan string, 100),
+		held: make(map[net.Conn][]int),
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.held[c] = nil
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *relpTestServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		txnr, cmd, data, err := readRELPFrame(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.cmds = append(s.cmds, cmd)
+		switch cmd {
+		case "open":
+			rsp := "200 OK\nrelp_version=0\ncommands=syslog"
+			fmt.Fprintf(c, "%d rsp %d %s\n", txnr, len(rsp), rsp)
+		case "syslog":
+			s.msgs <- string(data)
+			if s.holdAcks {
+				s.held[c] = append(s.held[c], txnr)
+			} else {
+				fmt.Fprintf(c, "%d rsp 6 200 OK\n", txnr)
+			}
+		case "close":
+			fmt.Fprintf(c, "%d rsp 0\n", txnr)
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *relpTestServer) setHoldAcks(hold bool) {
+	s.mu.Lock()
+	s.holdAcks = hold
+	s.mu.Unlock()
+}
+
+// release acknowledges every held transaction.
+func (s *relpTestServer) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, txnrs := range s.held {
+		for _, txnr := range txnrs {
+			fmt.Fprintf(c, "%d rsp 6 200 OK\n", txnr)
+		}
+		s.held[c] = nil
+	}
+}
+
+// dropConnections closes every client connection without acknowledging.
+func (s *relpTestServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.held {
+		c.Close()
+		delete(s.held, c)
+	}
+}
+
+func (s *relpTestServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.cmds...)
+}
+
+func (s *relpTestServer) expect(t *testing.T, content string) {
+	select {
+	case m := <-s.msgs:
+		if !strings.HasSuffix(m, ": "+content) {
+			t.Errorf("expected message %q, got %q", content, m)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %q", content)
+	}
+}
+
+func TestRELPWrite(t *testing.T) {
+	s := startRELPServer(t)
+	defer s.l.Close()
+
+	w, err := Dial("relp", s.l.Addr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	for _, m := range []string{"one", "two", "three"} {
+		if err := w.Err(m); err != nil {
+			t.Errorf("failed to write: %v", err)
+		}
+		s.expect(t, m)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("failed to close: %v", err)
+	}
+
+	cmds := s.commands()
+	if cmds[0] != "open" || cmds[len(cmds)-1] != "close" {
+		t.Errorf("expected an open and close handshake, got %v", cmds)
+	}
+}
+
+func TestRELPWindow(t *testing.T) {
+	s := startRELPServer(t)
+	defer s.l.Close()
+	s.setHoldAcks(true)
+
+	w, err := Dial("relp", s.l.Addr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetRELPWindow(2)
+
+	w.Err("one")
+	w.Err("two")
+	s.expect(t, "one")
+	s.expect(t, "two")
+
+	written := make(chan error)
+	go func() { written <- w.Err("three") }()
+	select {
+	case <-written:
+		t.Fatalf("write should block while the window is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.release()
+	if err := <-written; err != nil {
+		t.Errorf("failed to write: %v", err)
+	}
+	s.expect(t, "three")
+	s.setHoldAcks(false)
+	s.release()
+}
+
+func TestRELPAckWaitHonoursWriteTimeout(t *testing.T) {
+	s := startRELPServer(t)
+	defer s.l.Close()
+	s.setHoldAcks(true)
+
+	w, err := DialWithOptions("relp", s.l.Addr().String(), LOG_ERR, "tag", WithWriteTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	w.SetRELPWindow(1)
+
+	w.Err("one")
+	s.expect(t, "one")
+	start := time.Now()
+	if err := w.Err("two"); err == nil {
+		t.Errorf("expected the write to fail while the server withholds acknowledgements")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("write took %v, expected it to be bounded by the write timeout", elapsed)
+	}
+
+	start = time.Now()
+	w.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("close took %v, expected it to be bounded by the write timeout", elapsed)
+	}
+}
+
+func TestRELPResendAfterReconnect(t *testing.T) {
+	s := startRELPServer(t)
+	defer s.l.Close()
+	s.setHoldAcks(true)
+
+	w, err := Dial("relp", s.l.Addr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("one")
+	w.Err("two")
+	s.expect(t, "one")
+	s.expect(t, "two")
+
+	// The server goes away before acknowledging anything.
+	rc := w.getConn().(*relpConn)
+	s.setHoldAcks(false)
+	s.dropConnections()
+	<-rc.done
+
+	if err := w.Err("three"); err != nil {
+		t.Fatalf("failed to write after reconnect: %v", err)
+	}
+	s.expect(t, "one")
+	s.expect(t, "two")
+	s.expect(t, "three")
+}
+
+func TestRELPTxnrWraps(t *testing.T) {
+	r := &relpConn{txnr: relpMaxTxnr - 1, pending: make(map[int]string)}
+	for _, want := range []int{relpMaxTxnr, 1, 2} {
+		txnr := r.nextTxnrLocked()
+		if txnr != want {
+			t.Fatalf("expected transaction number %d, got %d", want, txnr)
+		}
+		r.pending[txnr] = fmt.Sprint(want)
+	}
+	if got := strings.Join(r.unackedLocked(), ","); got != fmt.Sprintf("%d,1,2", relpMaxTxnr) {
+		t.Errorf("expected unacknowledged messages in sending order, got %s", got)
+	}
+}
+
+func TestRELPOpenRejected(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		txnr, _, _, _ := readRELPFrame(bufio.NewReader(c))
+		fmt.Fprintf(c, "%d rsp 9 500 nope\n", txnr)
+	}()
+
+	if _, err := Dial("relp", l.Addr().String(), LOG_ERR, "tag"); err == nil {
+		t.Errorf("should fail when the server rejects the session")
+	}
+}
+
+func TestReadRELPFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("1 rsp 6 200 OK\n2 rsp 0\n3 syslog 5 a\nb c\n"))
+
+	txnr, cmd, data, err := readRELPFrame(r)
+	if txnr != 1 || cmd != "rsp" || string(data) != "200 OK" || err != nil {
+		t.Errorf("unexpected frame %d %q %q %v", txnr, cmd, data, err)
+	}
+	txnr, cmd, data, err = readRELPFrame(r)
+	if txnr != 2 || cmd != "rsp" || len(data) != 0 || err != nil {
+		t.Errorf("unexpected frame %d %q %q %v", txnr, cmd, data, err)
+	}
+	txnr, cmd, data, err = readRELPFrame(r)
+	if txnr != 3 || cmd != "syslog" || string(data) != "a\nb c" || err != nil {
+		t.Errorf("unexpected frame %d %q %q %v", txnr, cmd, data, err)
+	}
+
+	r = bufio.NewReader(strings.NewReader("x rsp 0\n"))
+	if _, _, _, err := readRELPFrame(r); err == nil {
+		t.Errorf("should fail on an invalid transaction number")
+	}
+
+	// header fields that never end must not be read without limit
+	for prefix, fill := range map[string]repeatByte{"": '1', "1 ": 'r'} {
+		r = bufio.NewReader(io.MultiReader(strings.NewReader(prefix), fill))
+		if _, _, _, err := readRELPFrame(r); err == nil {
+			t.Errorf("should fail on an endless header field after %q", prefix)
+		}
+	}
+
+	for _, frame := range []string{"1 rsp -1 x\n", "1 rsp 999999999 x\n", "1 rsp 1234567890 x\n"} {
+		r = bufio.NewReader(strings.NewReader(frame))
+		if _, _, _, err := readRELPFrame(r); err == nil {
+			t.Errorf("should fail on the data length of %q", frame)
+		}
+	}
+}
+
+// repeatByte is an endless reader of one byte.
+type repeatByte byte
+
+func (b repeatByte) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+func TestRELPMalformedResponse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		txnr, _, _, _ := readRELPFrame(r)
+		fmt.Fprintf(c, "%d rsp 6 200 OK\n", txnr)
+		readRELPFrame(r)
+		io.WriteString(c, "2 rsp -1 x\n")
+		io.Copy(io.Discard, r)
+	}()
+
+	w, err := Dial("relp", l.Addr().String(), LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.Err("first")
+
+	rc := w.getConn().(*relpConn)
+	select {
+	case <-rc.done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("a malformed frame should end the session")
+	}
+	rc.mu.Lock()
+	err = rc.err
+	rc.mu.Unlock()
+	if err == nil || !strings.Contains(err.Error(), "data length") {
+		t.Errorf("expected a protocol error, got %v", err)
+	}
+}
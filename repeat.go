@@ -0,0 +1,203 @@
+package srslog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRepeatWindow is how long repeated messages are collapsed before a
+// summary is sent, see WithRepeatSuppression.
+const DefaultRepeatWindow = 30 * time.Second
+
+// RepeatKey decides which messages a repeat is compared with, see
+// WithRepeatSuppression.
+type RepeatKey int
+
+const (
+	// RepeatByTag compares a message with the last message of the same
+	// tag, so any other message with that tag ends a run of repeats.
+	RepeatByTag RepeatKey = iota
+
+	// RepeatByPriority compares a message with the last message of the
+	// same priority, so messages of other priorities in between don't end
+	// a run of repeats.
+	RepeatByPriority
+)
+
+// WithRepeatSuppression collapses repeated messages the way syslogd does. A
+// message identical to the previous one with the same key, priority and
+// tag is not sent; instead, once window has passed since the first repeat,
+// or when a different message arrives, "last message repeated N times" is
+// sent with the same priority and tag. window defaults to
+// DefaultRepeatWindow.
+func WithRepeatSuppression(window time.Duration, key RepeatKey) Option {
+	return func(w *Writer) error {
+		if window <= 0 {
+			window = DefaultRepeatWindow
+		}
+		w.repeats = &repeatFilter{window: window, key: key, runs: make(map[repeatRunKey]*repeatRun)}
+		return nil
+	}
+}
+
+// repeatRunKey identifies the previous message a new one is compared with.
+type repeatRunKey struct {
+	tag string
+	p   Priority
+}
+
+// repeatRun is the previous message of a key and how often it has been
+// repeated since it was last sent or summarized.
+type repeatRun struct {
+	p        Priority
+	tag      string
+	hostname string
+	sd       []SDElement
+	msg      string
+	count    int
+
+	// timer fires at expires, to send the summary of the run or, if it has
+	// not been repeated within the window, forget it
+	timer   *time.Timer
+	expires time.Time
+}
+
+func (r *repeatRun) summary() Message {
+	return Message{
+		Priority:       r.p,
+		Content:        fmt.Sprintf("last message repeated %d times", r.count),
+		Hostname:       r.hostname,
+		Tag:            r.tag,
+		StructuredData: r.sd,
+	}
+}
+
+// repeatFilter collapses the repeated messages of a Writer.
+type repeatFilter struct {
+	window time.Duration
+	key    RepeatKey
+
+	mu     sync.Mutex
+	runs   map[repeatRunKey]*repeatRun
+	closed bool
+}
+
+// checkRepeat records a message and reports whether it repeats the
+// previous one and should not be sent. If it ends a run of repeats, the
+// summary to send first is returned too. Messages that override the
+// hostname or carry structured data only repeat messages with the same
+// hostname and structured data.
+func (w *Writer) checkRepeat(m Message) (summary *Message, suppressed bool) {
+	f := w.repeats
+	p, tag, hostname := m.Priority, w.tagOf(m), m.Hostname
+	msg := strings.TrimSuffix(m.Content, "\n")
+	k := repeatRunKey{tag: tag}
+	if f.key == RepeatByPriority {
+		k = repeatRunKey{p: p}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, false
+	}
+	run := f.runs[k]
+	if run != nil && run.p == p && run.tag == tag && run.hostname == hostname && run.msg == msg &&
+		formatStructuredData(run.sd) == formatStructuredData(m.StructuredData) {
+		run.count++
+		if run.count == 1 {
+			// the summary is sent a window after the first repeat
+			run.expires = time.Now().Add(f.window)
+			run.timer.Reset(f.window)
+		}
+		return nil, true
+	}
+
+	if run != nil {
+		run.timer.Stop()
+		if run.count > 0 {
+			s := run.summary()
+			summary = &s
+		}
+	}
+	run = &repeatRun{p: p, tag: tag, hostname: hostname, sd: m.StructuredData, msg: msg, expires: time.Now().Add(f.window)}
+	run.timer = time.AfterFunc(f.window, func() { w.expireRepeats(k, run) })
+	f.runs[k] = run
+	return summary, false
+}
+
+// expireRepeats sends the summary of run once its window has passed. Later
+// repeats of the same message start a new count; a run that was not
+// repeated within its window is forgotten, so keys that stop being logged
+// don't accumulate.
+func (w *Writer) expireRepeats(k repeatRunKey, run *repeatRun) {
+	f := w.repeats
+	f.mu.Lock()
+	if f.runs[k] != run || time.Now().Before(run.expires) {
+		// replaced, or the timer was reset after it fired
+		f.mu.Unlock()
+		return
+	}
+	if run.count == 0 {
+		delete(f.runs, k)
+		f.mu.Unlock()
+		return
+	}
+	summary := run.summary()
+	run.count = 0
+	run.expires = time.Now().Add(f.window)
+	run.timer.Reset(f.window)
+	f.mu.Unlock()
+
+	w.dispatch(context.Background(), summary)
+}
+
+// closeRepeats sends the summaries of all pending runs of repeats.
+func (w *Writer) closeRepeats() {
+	f := w.repeats
+	f.mu.Lock()
+	f.closed = true
+	var summaries []Message
+	for k, run := range f.runs {
+		run.timer.Stop()
+		if run.count > 0 {
+			summaries = append(summaries, run.summary())
+		}
+		delete(f.runs, k)
+	}
+	f.mu.Unlock()
+
+	for _, s := range summaries {
+		w.dispatch(context.Background(), s)
+	}
+}
+
+// writeRepeating writes a message through the repeat filter.
+func (w *Writer) writeRepeating(ctx context.Context, m Message) (int, error) {
+	summary, suppressed := w.checkRepeat(m)
+	if summary != nil {
+		w.dispatch(ctx, *summary)
+	}
+	if suppressed {
+		return len(m.Content), nil
+	}
+	return w.dispatch(ctx, m)
+}
+
+// filterRepeats applies the repeat filter to a batch.
+func (w *Writer) filterRepeats(msgs []Message) []Message {
+	filtered := make([]Message, 0, len(msgs))
+	for _, m := range msgs {
+		summary, suppressed := w.checkRepeat(m)
+		if summary != nil {
+			filtered = append(filtered, *summary)
+		}
+		if !suppressed {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
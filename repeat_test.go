@@ -0,0 +1,148 @@
+package srslog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receiveNext waits for the next message and checks it ends with content.
+func (s *testStreamServer) receiveNext(t *testing.T, content string) {
+	select {
+	case m := <-s.msgs:
+		if !strings.HasSuffix(m, content+"\n") {
+			t.Errorf("expected %q, got %q", content, m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %q", content)
+	}
+}
+
+func TestRepeatSuppression(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithRepeatSuppression(time.Minute, RepeatByTag))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := w.Err("disk full"); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	w.Warning("disk full")
+	w.Warning("disk full")
+	w.Err("recovered")
+
+	s.receiveNext(t, "disk full")
+	s.receiveNext(t, "last message repeated 4 times")
+	s.receiveNext(t, "disk full")
+	s.receiveNext(t, "last message repeated 1 times")
+	s.receiveNext(t, "recovered")
+}
+
+func TestRepeatSuppressionWindow(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithRepeatSuppression(50*time.Millisecond, RepeatByTag))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	w.Err("again")
+	w.Err("again")
+	w.Err("again")
+	s.receiveNext(t, "again")
+	s.receiveNext(t, "last message repeated 2 times")
+
+	// the next repeat is counted again, and summarized on Close
+	w.Err("again")
+	w.Close()
+	s.receiveNext(t, "last message repeated 1 times")
+}
+
+func TestRepeatSuppressionForgetsRuns(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithRepeatSuppression(20*time.Millisecond, RepeatByTag))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 10; i++ {
+		w.WriteMessage(&Message{Priority: LOG_ERR, Tag: fmt.Sprintf("tag%d", i), Content: "once"})
+		s.receiveNext(t, "once")
+	}
+	w.WriteMessage(&Message{Priority: LOG_ERR, Tag: "repeated", Content: "twice"})
+	w.WriteMessage(&Message{Priority: LOG_ERR, Tag: "repeated", Content: "twice"})
+	s.receiveNext(t, "twice")
+	s.receiveNext(t, "last message repeated 1 times")
+
+	f := w.repeats
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		f.mu.Lock()
+		n := len(f.runs)
+		f.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected expired runs to be forgotten, %d remain", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRepeatSuppressionByPriority(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithRepeatSuppression(time.Minute, RepeatByPriority))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("retrying")
+	w.Info("progress 1")
+	w.Err("retrying")
+	w.Info("progress 2")
+	w.Err("giving up")
+
+	s.receiveNext(t, "retrying")
+	s.receiveNext(t, "progress 1")
+	s.receiveNext(t, "progress 2")
+	s.receiveNext(t, "last message repeated 1 times")
+	s.receiveNext(t, "giving up")
+}
+
+func TestRepeatSuppressionBatch(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag", WithRepeatSuppression(time.Minute, RepeatByTag))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	err = w.WriteBatch([]Message{
+		{Priority: LOG_ERR, Content: "same"},
+		{Priority: LOG_ERR, Content: "same\n"},
+		{Priority: LOG_ERR, Content: "other"},
+	})
+	if err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	s.receiveNext(t, "same")
+	s.receiveNext(t, "last message repeated 1 times")
+	s.receiveNext(t, "other")
+}
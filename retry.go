@@ -0,0 +1,229 @@
+package srslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrDisconnected is returned by writes while a Writer with a RetryPolicy
+// is reconnecting in the background. It wraps the error of the last
+// reconnect attempt, if any.
+var ErrDisconnected = errors.New("srslog: disconnected")
+
+// A RetryPolicy decides how a Writer reconnects after losing its
+// connection. Backoff is called after attempt failed reconnect attempts,
+// counting from 1, and returns how long to wait before the next one, or
+// false to give up until the next write.
+type RetryPolicy interface {
+	Backoff(attempt int) (time.Duration, bool)
+}
+
+// ExponentialBackoff is a RetryPolicy whose delay starts at Initial and is
+// multiplied by Multiplier after each failed attempt, up to Max. Jitter is
+// the fraction of each delay, between 0 and 1, that is randomized, so that
+// many Writers don't reconnect in lockstep. After MaxAttempts failed
+// attempts, if it is positive, the Writer gives up until the next write.
+type ExponentialBackoff struct {
+	Initial     time.Duration // defaults to 100ms
+	Max         time.Duration // defaults to 30s
+	Multiplier  float64       // defaults to 2
+	Jitter      float64
+	MaxAttempts int
+}
+
+// Backoff implements RetryPolicy.
+func (b ExponentialBackoff) Backoff(attempt int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt >= b.MaxAttempts {
+		return 0, false
+	}
+	initial, max, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(initial)
+	for i := 1; i < attempt && delay < float64(max); i++ {
+		delay *= multiplier
+	}
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+	if b.Jitter > 0 {
+		jitter := b.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay), true
+}
+
+// WithRetryPolicy makes the Writer reconnect in a single background
+// goroutine, following policy, instead of in every write that fails. While
+// it reconnects, writes wait for it during the fail-fast window (see
+// WithFailFastWindow) and then fail immediately with ErrDisconnected.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(w *Writer) error {
+		w.retry = &reconnector{policy: policy, stop: make(chan struct{})}
+		return nil
+	}
+}
+
+// WithFailFastWindow sets how long after losing its connection a Writer
+// with a RetryPolicy lets writes wait for the reconnect. Once the Writer has
+// been disconnected for longer, writes fail at once. The default of zero
+// never waits.
+func WithFailFastWindow(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.failFastWindow = d
+		return nil
+	}
+}
+
+// reconnector runs the background reconnects of a Writer with a
+// RetryPolicy.
+type reconnector struct {
+	policy RetryPolicy
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	running bool
+	done    chan struct{} // closed when the running round ends
+	since   time.Time     // start of the outage, zero while connected
+	err     error         // of the last attempt
+	closed  bool
+}
+
+// reconnect replaces failed, if it is still the Writer's connection, with
+// one made by the background goroutine, starting it if needed. It returns
+// ErrDisconnected if no connection is made within the fail-fast window.
+func (w *Writer) reconnect(ctx context.Context, failed serverConn) (serverConn, error) {
+	if failed != nil {
+		w.dropConn(failed)
+	}
+
+	r := w.retry
+	r.mu.Lock()
+	if conn := w.getConn(); conn != nil {
+		r.mu.Unlock()
+		return conn, nil
+	}
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrDisconnected
+	}
+	if r.since.IsZero() {
+		r.since = time.Now()
+	}
+	if !r.running {
+		r.running = true
+		r.done = make(chan struct{})
+		go w.runReconnect()
+	}
+	done, deadline := r.done, r.since.Add(w.failFastWindow)
+	r.mu.Unlock()
+
+	if wait := time.Until(deadline); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, contextErr(ctx)
+		}
+	}
+	if conn := w.getConn(); conn != nil {
+		return conn, nil
+	}
+	return nil, r.disconnected()
+}
+
+// runReconnect tries to connect until it succeeds, the policy gives up or
+// the Writer is closed.
+func (w *Writer) runReconnect() {
+	r := w.retry
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		conn, hostname, err := w.getDialer().Call(ctx)
+		if err == nil {
+			r.mu.Lock()
+			if r.closed {
+				conn.close()
+				err = ErrDisconnected
+			} else {
+				w.setConnAndHostname(conn, hostname)
+				r.since = time.Time{}
+			}
+			r.finishLocked(err)
+			r.mu.Unlock()
+			return
+		}
+
+		delay, retry := r.policy.Backoff(attempt)
+		r.mu.Lock()
+		r.err = err
+		if !retry {
+			r.finishLocked(err)
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.stop:
+			timer.Stop()
+			r.mu.Lock()
+			r.finishLocked(err)
+			r.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (r *reconnector) finishLocked(err error) {
+	r.err = err
+	r.running = false
+	close(r.done)
+}
+
+func (r *reconnector) disconnected() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		return ErrDisconnected
+	}
+	return fmt.Errorf("%w: %w", ErrDisconnected, r.err)
+}
+
+// close stops the background reconnects. A connection made after it is
+// closed right away.
+func (r *reconnector) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.stop)
+	}
+}
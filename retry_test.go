@@ -0,0 +1,169 @@
+package srslog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Initial: 100 * time.Millisecond, Max: time.Second, MaxAttempts: 6}
+	expected := []time.Duration{100, 200, 400, 800, 1000}
+	for i, want := range expected {
+		got, ok := b.Backoff(i + 1)
+		if !ok || got != want*time.Millisecond {
+			t.Errorf("attempt %d: expected %v, got %v (%v)", i+1, want*time.Millisecond, got, ok)
+		}
+	}
+	if _, ok := b.Backoff(6); ok {
+		t.Errorf("should give up after MaxAttempts")
+	}
+
+	b = ExponentialBackoff{Initial: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		got, _ := b.Backoff(1)
+		if got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("jittered delay %v out of range", got)
+		}
+	}
+
+	if got, _ := (ExponentialBackoff{}).Backoff(1); got != 100*time.Millisecond {
+		t.Errorf("expected the default initial delay, got %v", got)
+	}
+}
+
+// flakyDialer dials addr over TCP unless it is down, and counts attempts.
+type flakyDialer struct {
+	addr  string
+	down  atomic.Bool
+	dials atomic.Int32
+}
+
+func (d *flakyDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dials.Add(1)
+	if d.down.Load() {
+		return nil, errors.New("collector down")
+	}
+	var nd net.Dialer
+	return nd.DialContext(ctx, "tcp", d.addr)
+}
+
+// breakConn kills s and waits until w has noticed.
+func breakConn(t *testing.T, w *Writer, s *testStreamServer) {
+	nc := w.getConn().(*netConn)
+	s.kill()
+	select {
+	case <-nc.gone:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("did not notice the closed connection")
+	}
+}
+
+func TestRetryPolicySingleReconnector(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR, "tag",
+		WithCustomDialContext(d.dial),
+		WithRetryPolicy(ExponentialBackoff{Initial: 50 * time.Millisecond, Max: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	d.dials.Store(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			if err := w.Err("during outage"); !errors.Is(err, ErrDisconnected) {
+				t.Errorf("expected ErrDisconnected, got %v", err)
+			}
+			if time.Since(start) > time.Second {
+				t.Errorf("writes should fail fast while disconnected")
+			}
+		}()
+	}
+	wg.Wait()
+	time.Sleep(120 * time.Millisecond)
+	if n := d.dials.Load(); n > 5 {
+		t.Errorf("expected a few paced reconnects, got %d", n)
+	}
+
+	s = startTestStreamServer(t, s.addr)
+	defer s.kill()
+	d.down.Store(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for w.Err("after outage") != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("did not reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.receive(t, "after outage")
+}
+
+func TestFailFastWindow(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR, "tag",
+		WithCustomDialContext(d.dial),
+		WithRetryPolicy(ExponentialBackoff{Initial: 20 * time.Millisecond, Max: 20 * time.Millisecond}),
+		WithFailFastWindow(time.Second))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	s = startTestStreamServer(t, s.addr)
+	defer s.kill()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		d.down.Store(false)
+	}()
+
+	if err := w.Err("within window"); err != nil {
+		t.Fatalf("should wait for the reconnect within the window, got %v", err)
+	}
+	s.receive(t, "within window")
+}
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR, "tag",
+		WithCustomDialContext(d.dial),
+		WithRetryPolicy(ExponentialBackoff{Initial: 10 * time.Millisecond, MaxAttempts: 2}),
+		WithFailFastWindow(time.Second))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	d.dials.Store(0)
+
+	err = w.Err("gives up")
+	if !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("expected ErrDisconnected, got %v", err)
+	}
+	if n := d.dials.Load(); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+
+	w.Err("starts again")
+	if n := d.dials.Load(); n != 4 {
+		t.Errorf("the next write should start another round, got %d attempts", n)
+	}
+}
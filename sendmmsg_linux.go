@@ -0,0 +1,64 @@
+//go:build linux && !386
+// +build linux,!386
+
+package srslog
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// mmsghdr is struct mmsghdr from sendmmsg(2).
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+}
+
+// sendDatagrams sends each of bufs as its own datagram, with as few
+// sendmmsg(2) calls as possible.
+func sendDatagrams(c *net.UDPConn, bufs [][]byte) (int, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return writeEach(c, bufs)
+	}
+
+	iovs := make([]syscall.Iovec, len(bufs))
+	hdrs := make([]mmsghdr, len(bufs))
+	for i, b := range bufs {
+		if len(b) > 0 {
+			iovs[i].Base = &b[0]
+			iovs[i].SetLen(len(b))
+		}
+		hdrs[i].hdr.Iov = &iovs[i]
+		hdrs[i].hdr.Iovlen = 1
+	}
+
+	sent := 0
+	var errno syscall.Errno
+	err = rc.Write(func(fd uintptr) bool {
+		for sent < len(hdrs) {
+			n, _, e := syscall.Syscall6(sysSendmmsg, fd,
+				uintptr(unsafe.Pointer(&hdrs[sent])), uintptr(len(hdrs)-sent), 0, 0, 0)
+			switch e {
+			case 0:
+				sent += int(n)
+			case syscall.EINTR:
+			case syscall.EAGAIN:
+				return false
+			default:
+				errno = e
+				return true
+			}
+		}
+		return true
+	})
+	runtime.KeepAlive(bufs)
+	runtime.KeepAlive(iovs)
+	if err == nil && errno != 0 {
+		err = os.NewSyscallError("sendmmsg", errno)
+	}
+	return sent, err
+}
@@ -0,0 +1,5 @@
+package srslog
+
+// sysSendmmsg is the number of sendmmsg(2), which syscall doesn't define on
+// amd64.
+const sysSendmmsg = 307
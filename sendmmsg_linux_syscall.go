@@ -0,0 +1,8 @@
+//go:build linux && !386 && !amd64
+// +build linux,!386,!amd64
+
+package srslog
+
+import "syscall"
+
+const sysSendmmsg = syscall.SYS_SENDMMSG
@@ -0,0 +1,11 @@
+//go:build !linux || 386
+// +build !linux 386
+
+package srslog
+
+import "net"
+
+// sendDatagrams sends each of bufs as its own datagram.
+func sendDatagrams(c *net.UDPConn, bufs [][]byte) (int, error) {
+	return writeEach(c, bufs)
+}
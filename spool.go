@@ -0,0 +1,660 @@
+package srslog
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSpoolSegmentSize is the size at which a spool starts a new
+	// segment file, see SpoolConfig.
+	DefaultSpoolSegmentSize = 4 << 20
+
+	// DefaultSpoolRetryInterval is how often a spool retries replaying
+	// while the destination is unreachable, see SpoolConfig.
+	DefaultSpoolRetryInterval = time.Second
+)
+
+// spoolSegmentExt is the extension of segment files.
+const spoolSegmentExt = ".seg"
+
+// spoolHeaderSize is the size of a record header: the length of the
+// payload and its CRC-32C.
+const spoolHeaderSize = 8
+
+var spoolCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errSpoolCorrupt = errors.New("srslog: corrupt spool record")
+
+// SpoolConfig configures the disk spool of a Writer, see WithSpool.
+type SpoolConfig struct {
+	// Dir holds the segment files. It is created if needed and must not
+	// be shared with another Writer.
+	Dir string
+
+	// SegmentSize is the size at which a new segment file is started. It
+	// defaults to DefaultSpoolSegmentSize.
+	SegmentSize int64
+
+	// MaxSize caps the total size of the segment files. When it is
+	// exceeded the oldest segment is dropped. Zero means no cap.
+	MaxSize int64
+
+	// MaxAge drops spooled messages older than this instead of replaying
+	// them. Zero means no cap.
+	MaxAge time.Duration
+
+	// RetryInterval is how often replay is retried while the destination
+	// is unreachable. It defaults to DefaultSpoolRetryInterval.
+	RetryInterval time.Duration
+}
+
+// SpoolStats describes the messages waiting in a Writer's spool.
+type SpoolStats struct {
+	Segments int       // number of segment files
+	Bytes    int64     // total size of the segment files
+	Messages int       // messages waiting to be replayed
+	Oldest   time.Time // time the oldest waiting message was written, zero if none
+	Dropped  uint64    // messages dropped by MaxSize and MaxAge
+	Corrupt  uint64    // messages lost to failed checksums
+}
+
+// WithSpool gives the Writer a spool directory for at-least-once delivery.
+// A message that cannot be sent, even after reconnecting, is formatted and
+// appended to a segment file on disk, and so is every message after it
+// until the spool has been replayed to the destination in order. Each
+// record is checksummed and synced to disk before the write returns.
+// Messages left in the directory by an earlier process are replayed too.
+// If the destination cannot be reached when dialing, the Writer is created
+// anyway: messages go to the spool and are replayed once it can connect.
+// With WithCircuitBreaker, messages are spooled rather than written to the
+// breaker's fallback, which only gets those the spool cannot take.
+//
+// A segment file is deleted once all its messages have been sent, so if
+// the process dies during replay, up to one segment may be sent again.
+func WithSpool(config SpoolConfig) Option {
+	return func(w *Writer) error {
+		s, err := openSpool(config)
+		if err != nil {
+			return err
+		}
+		w.spool = s
+		return nil
+	}
+}
+
+// SpoolStats returns the current state of the Writer's spool. It is zero
+// for a Writer without one.
+func (w *Writer) SpoolStats() SpoolStats {
+	w = w.root()
+	if w.spool == nil {
+		return SpoolStats{}
+	}
+	return w.spool.stats()
+}
+
+// spoolRecord is a spooled message. formatted is the output of the
+// Formatter at the time it was spooled; msg is kept for transports that
+// don't use a Formatter.
+type spoolRecord struct {
+	p         Priority
+	time      time.Time
+	hostname  string
+	tag       string
+	msg       string
+	formatted string
+}
+
+func (r *spoolRecord) encode() []byte {
+	payload := binary.AppendUvarint(nil, uint64(r.p))
+	payload = binary.AppendVarint(payload, r.time.UnixNano())
+	for _, s := range []string{r.hostname, r.tag, r.msg, r.formatted} {
+		payload = binary.AppendUvarint(payload, uint64(len(s)))
+		payload = append(payload, s...)
+	}
+
+	data := make([]byte, spoolHeaderSize, spoolHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.Checksum(payload, spoolCRCTable))
+	return append(data, payload...)
+}
+
+func decodeSpoolRecord(payload []byte) (*spoolRecord, error) {
+	p, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return nil, errSpoolCorrupt
+	}
+	payload = payload[n:]
+	nanos, n := binary.Varint(payload)
+	if n <= 0 {
+		return nil, errSpoolCorrupt
+	}
+	payload = payload[n:]
+
+	var fields [4]string
+	for i := range fields {
+		l, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload)-n) < l {
+			return nil, errSpoolCorrupt
+		}
+		fields[i] = string(payload[n : n+int(l)])
+		payload = payload[n+int(l):]
+	}
+	return &spoolRecord{
+		p:         Priority(p),
+		time:      time.Unix(0, nanos),
+		hostname:  fields[0],
+		tag:       fields[1],
+		msg:       fields[2],
+		formatted: fields[3],
+	}, nil
+}
+
+// readSpoolRecord reads the record at off in f and returns it with its
+// size on disk. It returns io.EOF at the end of the file, and
+// errSpoolCorrupt for a torn or damaged record.
+func readSpoolRecord(f *os.File, off int64) (*spoolRecord, int64, error) {
+	var header [spoolHeaderSize]byte
+	if n, err := f.ReadAt(header[:], off); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, 0, io.EOF
+		}
+		if err == io.EOF {
+			return nil, 0, errSpoolCorrupt
+		}
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	// The length is not covered by the checksum, so check it against what
+	// is left of the file before trusting it with an allocation.
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(length) > info.Size()-off-spoolHeaderSize {
+		return nil, 0, errSpoolCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, off+spoolHeaderSize); err != nil {
+		if err == io.EOF {
+			return nil, 0, errSpoolCorrupt
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, spoolCRCTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errSpoolCorrupt
+	}
+	r, err := decodeSpoolRecord(payload)
+	return r, spoolHeaderSize + int64(length), err
+}
+
+// spoolSegment is one segment file.
+type spoolSegment struct {
+	seq     uint64
+	path    string
+	size    int64
+	pending int // records not yet replayed
+}
+
+// spool is the on-disk queue of a Writer. Writers append to the last
+// segment, and the replayer reads from the first.
+type spool struct {
+	config  SpoolConfig
+	dropped atomic.Uint64
+	corrupt atomic.Uint64
+
+	mu       sync.Mutex
+	segments []*spoolSegment // oldest first
+	out      *os.File        // open for appending to the last segment
+	in       *os.File        // open for replaying the first segment
+	inOff    int64
+	nextSeq  uint64
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openSpool opens the spool in config.Dir and recovers its segments. A
+// segment that ends in a torn or damaged record, as left by a crash, is
+// truncated before that record.
+func openSpool(config SpoolConfig) (*spool, error) {
+	if config.Dir == "" {
+		return nil, errors.New("srslog: spool needs a directory")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSpoolSegmentSize
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultSpoolRetryInterval
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		config: config,
+		kick:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	paths, err := filepath.Glob(filepath.Join(config.Dir, "*"+spoolSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := recoverSpoolSegment(seq, path)
+		if err != nil {
+			return nil, err
+		}
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+		if seg.pending == 0 {
+			os.Remove(path)
+			continue
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return s, nil
+}
+
+func recoverSpoolSegment(seq uint64, path string) (*spoolSegment, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seg := &spoolSegment{seq: seq, path: path}
+	for {
+		_, size, err := readSpoolRecord(f, seg.size)
+		if err == io.EOF {
+			return seg, nil
+		}
+		if err == errSpoolCorrupt {
+			if err := f.Truncate(seg.size); err != nil {
+				return nil, err
+			}
+			return seg, f.Sync()
+		}
+		if err != nil {
+			return nil, err
+		}
+		seg.size += size
+		seg.pending++
+	}
+}
+
+// append writes r to the last segment, starting a new one if it is full,
+// and syncs it to disk.
+func (s *spool) append(r *spoolRecord) error {
+	data := r.encode()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped() {
+		return ErrClosed
+	}
+	var last *spoolSegment
+	if s.out != nil {
+		last = s.segments[len(s.segments)-1]
+	}
+	if last == nil || (last.size > 0 && last.size+int64(len(data)) > s.config.SegmentSize) {
+		var err error
+		if last, err = s.startSegmentLocked(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.out.Write(data); err != nil {
+		s.out.Truncate(last.size)
+		return err
+	}
+	if err := s.out.Sync(); err != nil {
+		return err
+	}
+	last.size += int64(len(data))
+	last.pending++
+	s.enforceMaxSizeLocked()
+
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// startSegmentLocked closes the segment being appended to and creates the
+// next one.
+func (s *spool) startSegmentLocked() (*spoolSegment, error) {
+	if s.out != nil {
+		s.out.Close()
+		s.out = nil
+	}
+	seg := &spoolSegment{
+		seq:  s.nextSeq,
+		path: filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", s.nextSeq, spoolSegmentExt)),
+	}
+	f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the new file survives a crash.
+	if dir, err := os.Open(s.config.Dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	s.nextSeq++
+	s.out = f
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+// enforceMaxSizeLocked drops the oldest segments while the spool is larger
+// than MaxSize, always keeping the one being appended to.
+func (s *spool) enforceMaxSizeLocked() {
+	if s.config.MaxSize <= 0 {
+		return
+	}
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	for total > s.config.MaxSize && len(s.segments) > 1 {
+		total -= s.segments[0].size
+		s.dropped.Add(uint64(s.segments[0].pending))
+		s.removeFirstLocked()
+	}
+}
+
+// removeFirstLocked deletes the first segment.
+func (s *spool) removeFirstLocked() {
+	seg := s.segments[0]
+	if s.in != nil {
+		s.in.Close()
+		s.in = nil
+	}
+	s.inOff = 0
+	if len(s.segments) == 1 && s.out != nil {
+		s.out.Close()
+		s.out = nil
+	}
+	os.Remove(seg.path)
+	s.segments = s.segments[1:]
+}
+
+// peekLocked returns the next record to replay, the segment it is in and
+// its size, or false if there is none. Damaged segments are dropped.
+func (s *spool) peekLocked() (*spoolRecord, *spoolSegment, int64, bool) {
+	for len(s.segments) > 0 {
+		seg := s.segments[0]
+		if seg.pending == 0 {
+			// All replayed. If it is being appended to, the next append
+			// starts a new segment.
+			s.removeFirstLocked()
+			continue
+		}
+
+		if s.in == nil {
+			f, err := os.Open(seg.path)
+			if err != nil {
+				s.corrupt.Add(uint64(seg.pending))
+				s.removeFirstLocked()
+				continue
+			}
+			s.in = f
+		}
+		r, size, err := readSpoolRecord(s.in, s.inOff)
+		if err != nil {
+			s.corrupt.Add(uint64(seg.pending))
+			s.removeFirstLocked()
+			continue
+		}
+		return r, seg, size, true
+	}
+	return nil, nil, 0, false
+}
+
+// commit marks the record peeked at from seg as replayed, unless the
+// segment was dropped in the meantime.
+func (s *spool) commit(seg *spoolSegment, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.segments) == 0 || s.segments[0] != seg {
+		return
+	}
+	s.inOff += size
+	seg.pending--
+}
+
+func (s *spool) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, seg := range s.segments {
+		n += seg.pending
+	}
+	return n
+}
+
+func (s *spool) stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SpoolStats{
+		Segments: len(s.segments),
+		Dropped:  s.dropped.Load(),
+		Corrupt:  s.corrupt.Load(),
+	}
+	for _, seg := range s.segments {
+		st.Bytes += seg.size
+		st.Messages += seg.pending
+	}
+	if st.Messages > 0 {
+		if r, _, _, ok := s.peekLocked(); ok {
+			st.Oldest = r.time
+		}
+	}
+	return st
+}
+
+func (s *spool) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the replayer and closes the segment files. Messages not yet
+// replayed stay on disk.
+func (s *spool) close() {
+	s.mu.Lock()
+	if s.stopped() {
+		s.mu.Unlock()
+		return
+	}
+	close(s.stop)
+	s.mu.Unlock()
+	if s.done != nil {
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.in != nil {
+		s.in.Close()
+		s.in = nil
+	}
+	if s.out != nil {
+		s.out.Close()
+		s.out = nil
+	}
+}
+
+// connFormatter returns the Formatter the Writer's connection would use,
+// for formatting messages that are spooled or sent elsewhere.
+func (w *Writer) connFormatter() MessageFormatter {
+	if w.formatter != nil {
+		return w.formatter
+	}
+	switch w.network {
+	case "", "unix", "unixgram":
+		return w.LocalFormat().formatter()
+	}
+	return DefaultMessageFormatter
+}
+
+// deliver sends a message, or appends it to the spool if the Writer has
+// one and the message cannot be sent or older messages are still waiting.
+func (w *Writer) deliver(ctx context.Context, m Message) (int, error) {
+	if w.spool == nil {
+		return w.send(ctx, m)
+	}
+	if w.spool.pending() == 0 {
+		n, err := w.send(ctx, m)
+		if err == nil || contextErr(ctx) != nil {
+			return n, err
+		}
+	}
+
+	n, err := w.spoolMessage(m)
+	if err != nil {
+		return w.writeFallback(ctx, m, err)
+	}
+	return n, nil
+}
+
+// spoolMessage formats a message and appends it to the spool. It keeps the
+// time the message was written, or its Timestamp, for its header.
+func (w *Writer) spoolMessage(m Message) (int, error) {
+	m = w.resolve(m)
+	s := m.Content
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	r := &spoolRecord{p: m.Priority, time: m.Timestamp, hostname: m.Hostname, tag: m.Tag, msg: s}
+	if r.time.IsZero() {
+		r.time = time.Now()
+	}
+	m.Content, m.Timestamp = s, r.time
+	r.formatted = w.connFormatter()(&m)
+	if err := w.spool.append(r); err != nil {
+		return 0, err
+	}
+	return len(s), nil
+}
+
+// startSpool starts replaying the spool in the background.
+func (w *Writer) startSpool() {
+	s := w.spool
+	s.done = make(chan struct{})
+	go w.replaySpool()
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// replaySpool sends spooled messages whenever some are appended, and
+// retries periodically while the destination is unreachable.
+func (w *Writer) replaySpool() {
+	s := w.spool
+	defer close(s.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(s.config.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.kick:
+		case <-ticker.C:
+		}
+		w.drainSpool(ctx)
+	}
+}
+
+// drainSpool replays spooled messages in order until the spool is empty
+// or a message cannot be sent.
+func (w *Writer) drainSpool(ctx context.Context) {
+	s := w.spool
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		r, seg, size, ok := s.peekLocked()
+		s.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		if s.config.MaxAge > 0 && time.Since(r.time) > s.config.MaxAge {
+			s.dropped.Add(1)
+			s.commit(seg, size)
+			continue
+		}
+		if err := w.sendSpooled(ctx, r); err != nil {
+			return
+		}
+		s.commit(seg, size)
+	}
+}
+
+// sendSpooled sends a spooled record as it was formatted, connecting
+// first if needed.
+func (w *Writer) sendSpooled(ctx context.Context, r *spoolRecord) error {
+	conn := w.getConn()
+	if conn == nil {
+		var err error
+		if conn, err = w.redial(ctx, nil); err != nil {
+			return err
+		}
+	}
+
+	formatted := func(*Message) string { return r.formatted }
+	m := &Message{Priority: r.p, Content: r.msg, Hostname: r.hostname, Tag: r.tag, Timestamp: r.time}
+	err := conn.writeString(ctx, w.framer, formatted, m)
+	if err != nil {
+		w.dropConn(conn)
+	}
+	return err
+}
+
+// dropConn closes conn if it is still the Writer's connection, so that the
+// next write reconnects.
+func (w *Writer) dropConn(conn serverConn) {
+	w.mu.Lock()
+	current := w.conn == conn
+	if current {
+		w.conn = nil
+	}
+	w.mu.Unlock()
+	if current {
+		conn.close()
+	}
+}
@@ -0,0 +1,206 @@
+package srslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpoolRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	for _, msg := range []string{"one\n", "two\n"} {
+		r := &spoolRecord{p: LOG_ERR, time: time.Now(), hostname: "host", tag: "tag", msg: msg, formatted: "<3>" + msg}
+		if err := s.append(r); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	s.close()
+
+	// A crash in the middle of an append leaves a torn record.
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if len(paths) != 1 {
+		t.Fatalf("expected one segment, got %v", paths)
+	}
+	f, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	s, err = openSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to reopen spool: %v", err)
+	}
+	defer s.close()
+	if st := s.stats(); st.Messages != 2 || st.Corrupt != 0 {
+		t.Fatalf("expected the two complete records, got %+v", st)
+	}
+	s.mu.Lock()
+	r, _, _, ok := s.peekLocked()
+	s.mu.Unlock()
+	if !ok || r.p != LOG_ERR || r.hostname != "host" || r.tag != "tag" || r.msg != "one\n" || r.formatted != "<3>one\n" {
+		t.Errorf("unexpected first record %+v", r)
+	}
+}
+
+func TestSpoolChecksum(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer s.close()
+	s.append(&spoolRecord{p: LOG_ERR, time: time.Now(), msg: "damaged\n", formatted: "damaged\n"})
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	data, _ := os.ReadFile(paths[0])
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(paths[0], data, 0600)
+
+	s.mu.Lock()
+	_, _, _, ok := s.peekLocked()
+	s.mu.Unlock()
+	if ok {
+		t.Errorf("a record with a bad checksum should not be replayed")
+	}
+	if st := s.stats(); st.Corrupt != 1 || st.Messages != 0 {
+		t.Errorf("expected one corrupt record, got %+v", st)
+	}
+}
+
+func TestSpoolRecordLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "torn"+spoolSegmentExt)
+	// A damaged header claiming a 4 GiB record.
+	if err := os.WriteFile(path, []byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0, 'x'}, 0600); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	defer f.Close()
+	if _, _, err := readSpoolRecord(f, 0); err != errSpoolCorrupt {
+		t.Errorf("expected errSpoolCorrupt for a length beyond the file, got %v", err)
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	s, err := openSpool(SpoolConfig{Dir: t.TempDir(), SegmentSize: 100, MaxSize: 250})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer s.close()
+
+	msg := strings.Repeat("x", 60) + "\n"
+	for i := 0; i < 10; i++ {
+		s.append(&spoolRecord{p: LOG_INFO, time: time.Now(), msg: msg, formatted: msg})
+	}
+	st := s.stats()
+	if st.Bytes > 250 || st.Dropped == 0 || st.Messages+int(st.Dropped) != 10 {
+		t.Errorf("expected the oldest segments to be dropped, got %+v", st)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	d := &flakyDialer{addr: s.addr}
+	dir := t.TempDir()
+	w, err := DialWithOptions("custom", s.addr, LOG_ERR, "tag",
+		WithCustomDialContext(d.dial),
+		WithSpool(SpoolConfig{Dir: dir, RetryInterval: 20 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	d.down.Store(true)
+	breakConn(t, w, s)
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := w.Err(msg); err != nil {
+			t.Fatalf("spooling %q should not fail: %v", msg, err)
+		}
+	}
+	if st := w.SpoolStats(); st.Messages != 3 || st.Oldest.IsZero() {
+		t.Fatalf("expected three spooled messages, got %+v", st)
+	}
+
+	s = startTestStreamServer(t, s.addr)
+	defer s.kill()
+	d.down.Store(false)
+	w.Err("four")
+	for _, want := range []string{"one", "two", "three", "four"} {
+		select {
+		case m := <-s.msgs:
+			if !strings.Contains(m, want) {
+				t.Fatalf("expected %q, got %q", want, m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	if st := w.SpoolStats(); st.Messages != 0 {
+		t.Errorf("expected an empty spool, got %+v", st)
+	}
+}
+
+func TestSpoolDialWhileDown(t *testing.T) {
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	addr := s.addr
+	s.kill()
+
+	w, err := DialWithOptions("tcp", addr, LOG_ERR, "tag",
+		WithSpool(SpoolConfig{Dir: t.TempDir(), RetryInterval: 20 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("a Writer with a spool should dial while the destination is down: %v", err)
+	}
+	defer w.Close()
+	if err := w.Err("spooled"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if st := w.SpoolStats(); st.Messages != 1 {
+		t.Fatalf("expected one spooled message, got %+v", st)
+	}
+
+	s = startTestStreamServer(t, addr)
+	defer s.kill()
+	s.receive(t, "spooled")
+}
+
+func TestSpoolReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	sp.append(&spoolRecord{p: LOG_ERR, time: time.Now(), tag: "tag", msg: "left over\n", formatted: "<3>left over\n"})
+	sp.append(&spoolRecord{p: LOG_ERR, time: time.Now().Add(-time.Hour), tag: "tag", msg: "expired\n", formatted: "<3>expired\n"})
+	sp.close()
+
+	s := startTestStreamServer(t, "127.0.0.1:0")
+	defer s.kill()
+	w, err := DialWithOptions("tcp", s.addr, LOG_ERR, "tag",
+		WithSpool(SpoolConfig{Dir: dir, MaxAge: time.Minute}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	s.receive(t, "left over")
+	deadline := time.Now().Add(2 * time.Second)
+	for w.SpoolStats().Messages != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the spool was not drained: %+v", w.SpoolStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := w.SpoolStats(); st.Dropped != 1 {
+		t.Errorf("expected the expired message to be dropped, got %+v", st)
+	}
+}
@@ -1,6 +1,7 @@
 package srslog
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -13,14 +14,20 @@ import (
 // This interface allows us to work with both local and network connections,
 // and enables Solaris support (see syslog_unix.go).
 type serverConn interface {
-	writeString(framer Framer, formatter Formatter, p Priority, hostname, tag, s string) error
+	writeString(ctx context.Context, framer Framer, formatter MessageFormatter, m *Message) error
 	close() error
 }
 
 // DialFunc is the function signature to be used for a custom dialer callback
-// with DialWithCustomDialer
+// with DialWithCustomDialer. It is not given a context, so no dial timeout
+// applies to it; use a DialContextFunc to bound how long dialing may take.
 type DialFunc func(string, string) (net.Conn, error)
 
+// DialContextFunc is the context-aware counterpart of DialFunc, to be used
+// with WithCustomDialContext. The context is cancelled or expires when the
+// Writer gives up on connecting, and carries the WithDialTimeout deadline.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 // New establishes a new connection to the system log daemon.  Each
 // write to the returned Writer sends a log message with the given
 // priority and prefix.
@@ -50,7 +57,7 @@ func DialWithCustomDialer(network, raddr string, priority Priority, tag string,
 	if customDial == nil {
 		return nil, ErrNilDialFunc
 	}
-	return dialAllParameters(network, raddr, priority, tag, nil, customDial)
+	return dialAllParameters(context.Background(), network, raddr, priority, tag, nil, customDial)
 }
 
 // DialWithTLSCertPath establishes a secure connection to a log daemon by connecting to
@@ -81,11 +88,62 @@ func DialWithTLSCert(network, raddr string, priority Priority, tag string, serve
 // DialWithTLSConfig establishes a secure connection to a log daemon by connecting to
 // address raddr on the specified network. It uses tlsConfig to configure the secure connection.
 func DialWithTLSConfig(network, raddr string, priority Priority, tag string, tlsConfig *tls.Config) (*Writer, error) {
-	return dialAllParameters(network, raddr, priority, tag, tlsConfig, nil)
+	return dialAllParameters(context.Background(), network, raddr, priority, tag, tlsConfig, nil)
+}
+
+// An Option configures a Writer created with DialWithOptions. Options are
+// applied before the first connection is made.
+type Option func(w *Writer) error
+
+// WithLocalSocketPaths sets the sockets tried, in order, when connecting to
+// the local syslog daemon with an empty network. Paths starting with "@"
+// are Linux abstract sockets. The default is DefaultLocalSocketPaths.
+func WithLocalSocketPaths(paths ...string) Option {
+	return func(w *Writer) error {
+		w.localPaths = append([]string(nil), paths...)
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used by the "tcp+tls" and
+// "relp" networks, like DialWithTLSConfig.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(w *Writer) error {
+		w.tlsConfig = config
+		return nil
+	}
+}
+
+// WithCustomDialContext makes the "custom" network connect by calling
+// customDial, like DialWithCustomDialer, but passes along the context of
+// each connection attempt. If customDial is nil, dialing fails with
+// ErrNilDialFunc.
+func WithCustomDialContext(customDial DialContextFunc) Option {
+	return func(w *Writer) error {
+		if customDial == nil {
+			return ErrNilDialFunc
+		}
+		w.customDialContext = customDial
+		return nil
+	}
+}
+
+// DialWithOptions establishes a connection to a log daemon like Dial, after
+// configuring the Writer with opts.
+func DialWithOptions(network, raddr string, priority Priority, tag string, opts ...Option) (*Writer, error) {
+	return dialAllParameters(context.Background(), network, raddr, priority, tag, nil, nil, opts...)
+}
+
+// DialContext is like DialWithOptions, but connecting, including any TLS or
+// RELP handshake, is abandoned when ctx is cancelled or expires. The
+// context only applies to the initial connection; reconnects use the
+// context of the write that triggers them.
+func DialContext(ctx context.Context, network, raddr string, priority Priority, tag string, opts ...Option) (*Writer, error) {
+	return dialAllParameters(ctx, network, raddr, priority, tag, nil, nil, opts...)
 }
 
 // implementation of the various functions above
-func dialAllParameters(network, raddr string, priority Priority, tag string, tlsConfig *tls.Config, customDial DialFunc) (*Writer, error) {
+func dialAllParameters(ctx context.Context, network, raddr string, priority Priority, tag string, tlsConfig *tls.Config, customDial DialFunc, opts ...Option) (*Writer, error) {
 	if err := validatePriority(priority); err != nil {
 		return nil, err
 	}
@@ -104,12 +162,31 @@ func dialAllParameters(network, raddr string, priority Priority, tag string, tls
 		tlsConfig:  tlsConfig,
 		customDial: customDial,
 	}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			if w.spool != nil {
+				w.spool.close()
+			}
+			return nil, err
+		}
+	}
 
-	_, err := w.connect()
-	if err != nil {
+	// A Writer with a spool starts disconnected rather than failing, and
+	// spools messages until it can connect.
+	_, err := w.connectContext(ctx)
+	if err != nil && (w.spool == nil || contextErr(ctx) != nil) {
+		if w.spool != nil {
+			w.spool.close()
+		}
 		return nil, err
 	}
-	return w, err
+	if w.spool != nil {
+		w.startSpool()
+	}
+	if w.async != nil {
+		w.startAsync()
+	}
+	return w, nil
 }
 
 // NewLogger creates a log.Logger whose output is written to
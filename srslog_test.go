@@ -2,6 +2,7 @@ package srslog
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"net"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -187,7 +189,11 @@ func TestWithSimulated(t *testing.T) {
 		if err != nil {
 			t.Fatalf("log failed: %v", err)
 		}
-		check(t, msg, <-done)
+		if tr == "unix" || tr == "unixgram" {
+			checkLocal(t, msg, <-done)
+		} else {
+			check(t, msg, <-done)
+		}
 		s.Close()
 	}
 }
@@ -213,7 +219,7 @@ func TestFlap(t *testing.T) {
 	if err != nil {
 		t.Fatalf("log failed: %v", err)
 	}
-	check(t, msg, <-done)
+	checkLocal(t, msg, <-done)
 
 	// restart the server
 	_, sock2, srvWG2 := startServer(net, addr, done)
@@ -226,7 +232,7 @@ func TestFlap(t *testing.T) {
 	if err != nil {
 		t.Fatalf("log failed: %v", err)
 	}
-	check(t, msg, <-done)
+	checkLocal(t, msg, <-done)
 
 	s.Close()
 }
@@ -305,6 +311,18 @@ func check(t *testing.T, in, out string) {
 	}
 }
 
+// checkLocal checks a message sent over a local socket, which uses the
+// UnixFormatter and has no hostname.
+func checkLocal(t *testing.T, in, out string) {
+	prefix := fmt.Sprintf("<%d>", LOG_USER+LOG_INFO)
+	suffix := fmt.Sprintf(" syslog_test[%d]: %s\n", os.Getpid(), in)
+	if !strings.HasPrefix(out, prefix) || !strings.HasSuffix(out, suffix) {
+		t.Errorf("Got %q, expected %q...%q", out, prefix, suffix)
+	} else if _, err := time.Parse(time.Stamp, out[len(prefix):len(out)-len(suffix)]); err != nil {
+		t.Errorf("Got %q, expected a time.Stamp timestamp: %v", out, err)
+	}
+}
+
 func checkWithPriorityAndTag(t *testing.T, p Priority, tag, hostname, in, out string) {
 	tmpl := fmt.Sprintf("<%d>%%s %%s %s[%%d]: %s\n", p, tag, in)
 	var parsedHostname, timestamp string
@@ -511,7 +529,8 @@ func TestConcurrentReconnect(t *testing.T) {
 			defer wg.Done()
 			w, err := Dial(net, addr, LOG_USER|LOG_ERR, "tag")
 			if err != nil {
-				t.Fatalf("syslog.Dial() failed: %v", err)
+				t.Errorf("syslog.Dial() failed: %v", err)
+				return
 			}
 			defer w.Close()
 			for i := 0; i < M; i++ {
@@ -541,7 +560,7 @@ func TestLocalConn(t *testing.T) {
 
 	lc := localConn{conn: conn}
 
-	lc.writeString(nil, nil, LOG_ERR, "hostname", "tag", "content")
+	lc.writeString(context.Background(), nil, nil, &Message{Priority: LOG_ERR, Hostname: "hostname", Tag: "tag", Content: "content"})
 
 	if len(messages) != 1 {
 		t.Errorf("should write one message")
@@ -570,3 +589,102 @@ func (c testLocalConn) Write(b []byte) (int, error) {
 func (c testLocalConn) Close() error {
 	return nil
 }
+
+func TestLocalConnStreamDelimiter(t *testing.T) {
+	messages := make([]string, 0)
+	lc := localConn{conn: newTestLocalConn(&messages), stream: true}
+
+	lc.writeString(context.Background(), nil, nil, &Message{Priority: LOG_ERR, Hostname: "hostname", Tag: "tag", Content: "no newline"})
+	lc.writeString(context.Background(), nil, nil, &Message{Priority: LOG_ERR, Hostname: "hostname", Tag: "tag", Content: "newline\n"})
+
+	for _, m := range messages {
+		if !strings.HasSuffix(m, "\n") || strings.HasSuffix(m, "\n\n") {
+			t.Errorf("expected exactly one trailing newline, got %q", m)
+		}
+	}
+}
+
+func TestLocalSocketPaths(t *testing.T) {
+	for _, n := range []string{"unix", "unixgram"} {
+		if !testableNetwork(n) {
+			continue
+		}
+		done := make(chan string)
+		addr, sock, srvWG := startServer(n, "", done)
+
+		w, err := DialWithOptions("", "", LOG_USER|LOG_INFO, "syslog_test",
+			WithLocalSocketPaths("/nonexistent/log", addr))
+		if err != nil {
+			t.Fatalf("%s: Dial() failed: %v", n, err)
+		}
+		if w.hostname == "" {
+			t.Errorf("%s: expected a hostname", n)
+		}
+		w.Info("custom path")
+		checkLocal(t, "custom path", <-done)
+
+		w.Close()
+		sock.Close()
+		srvWG.Wait()
+		os.Remove(addr)
+	}
+}
+
+func TestLocalAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("abstract sockets are not supported on %s", runtime.GOOS)
+	}
+	done := make(chan string)
+	name := fmt.Sprintf("@srslog-test-%d", os.Getpid())
+	_, sock, srvWG := startServer("unixgram", name, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	w, err := DialWithOptions("", "", LOG_USER|LOG_INFO, "syslog_test", WithLocalSocketPaths(name))
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer w.Close()
+	w.Info("abstract")
+	checkLocal(t, "abstract", <-done)
+}
+
+func TestLocalDialError(t *testing.T) {
+	_, err := DialWithOptions("", "", LOG_ERR, "tag", WithLocalSocketPaths("/nonexistent/a", "/nonexistent/b"))
+	dialErr, ok := err.(*LocalDialError)
+	if !ok {
+		t.Fatalf("expected a *LocalDialError, got %v", err)
+	}
+	if len(dialErr.Attempts) != 4 {
+		t.Fatalf("expected 4 attempts, got %v", dialErr.Attempts)
+	}
+	for _, path := range []string{"/nonexistent/a", "/nonexistent/b"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("expected %q in %q", path, err)
+		}
+	}
+	if a := dialErr.Attempts[1]; a.Network != "unix" || a.Path != "/nonexistent/a" || a.Err == nil {
+		t.Errorf("unexpected attempt %+v", a)
+	}
+}
+
+func TestLocalDialerHostname(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("unixgram", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+	defer os.Remove(addr)
+
+	w := Writer{network: "unixgram", raddr: addr}
+	conn, hostname, err := w.localDialer(context.Background())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.close()
+	if hostname != "localhost" {
+		t.Errorf("expected localhost as the default hostname, got %q", hostname)
+	}
+	if lc, ok := conn.(*localConn); !ok || lc.stream {
+		t.Errorf("expected a datagram localConn, got %#v", conn)
+	}
+}
@@ -1,11 +1,40 @@
 package srslog
 
 import (
-	"errors"
+	"context"
 	"io"
 	"net"
+	"strings"
+	"time"
 )
 
+// DefaultLocalSocketPaths are the sockets tried, in order, when connecting
+// to the local syslog daemon without configured paths.
+var DefaultLocalSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// LocalDialError is returned when none of the local syslog sockets could
+// be connected to. It records every socket that was tried and why it
+// failed.
+type LocalDialError struct {
+	Attempts []LocalDialAttempt
+}
+
+// LocalDialAttempt is a single failed attempt to connect to a local
+// socket.
+type LocalDialAttempt struct {
+	Network string
+	Path    string
+	Err     error
+}
+
+func (e *LocalDialError) Error() string {
+	reasons := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		reasons[i] = a.Err.Error()
+	}
+	return "Unix syslog delivery error: " + strings.Join(reasons, "; ")
+}
+
 // unixSyslog opens a connection to the syslog daemon running on the
 // local machine using a Unix domain socket. This function exists because of
 // Solaris support as implemented by gccgo.  On Solaris you can not
@@ -13,38 +42,74 @@ import (
 // sources have a syslog_solaris.go file that implements unixSyslog to
 // return a type that satisfies the serverConn interface and simply calls the C
 // library syslog function.
-func unixSyslog() (conn serverConn, err error) {
-	logTypes := []string{"unixgram", "unix"}
-	logPaths := []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
-	for _, network := range logTypes {
-		for _, path := range logPaths {
-			conn, err := net.Dial(network, path)
-			if err != nil {
-				continue
-			} else {
-				return &localConn{conn: conn}, nil
+//
+// Each path is tried as a datagram socket first and as a stream socket
+// second; paths starting with "@" are Linux abstract sockets. If paths is
+// empty, DefaultLocalSocketPaths is used. Messages are sent in format
+// unless the Writer has a Formatter.
+func unixSyslog(ctx context.Context, paths []string, format LocalFormat, dialer *net.Dialer, writeTimeout time.Duration) (conn serverConn, err error) {
+	if len(paths) == 0 {
+		paths = DefaultLocalSocketPaths
+	}
+	dialErr := &LocalDialError{}
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := dialLocal(ctx, dialer, network, path, format, writeTimeout)
+			if err == nil {
+				return conn, nil
 			}
+			dialErr.Attempts = append(dialErr.Attempts, LocalDialAttempt{network, path, err})
 		}
 	}
-	return nil, errors.New("Unix syslog delivery error")
+	return nil, dialErr
+}
+
+// dialLocal connects to a single local socket, resolving LocalFormatAuto
+// for the daemon behind it.
+func dialLocal(ctx context.Context, dialer *net.Dialer, network, path string, format LocalFormat, writeTimeout time.Duration) (*localConn, error) {
+	conn, err := dialer.DialContext(ctx, network, path)
+	if err != nil {
+		return nil, err
+	}
+	if format == LocalFormatAuto {
+		format = detectLocalFormat(path)
+	}
+	return &localConn{conn: conn, stream: network == "unix", format: format, writeTimeout: writeTimeout}, nil
 }
 
 // localConn adheres to the serverConn interface, allowing us to send syslog
 // messages to the local syslog daemon over a Unix domain socket.
 type localConn struct {
 	conn io.WriteCloser
+
+	// stream is set for SOCK_STREAM sockets, where messages have no
+	// boundaries of their own and must be delimited.
+	stream bool
+
+	// format is used when the Writer has no Formatter.
+	format LocalFormat
+
+	writeTimeout time.Duration
 }
 
-// writeString formats syslog messages using time.Stamp instead of time.RFC3339,
-// and omits the hostname (because it is expected to be used locally).
-func (n *localConn) writeString(framer Framer, formatter Formatter, p Priority, hostname, tag, msg string) error {
+// writeString formats syslog messages in the connection's LocalFormat,
+// which by default uses time.Stamp instead of time.RFC3339 and omits the
+// hostname (because it is expected to be used locally). On stream sockets
+// every message is terminated by a newline, which is the delimiter local
+// daemons split stream input on.
+func (n *localConn) writeString(ctx context.Context, framer Framer, formatter MessageFormatter, m *Message) error {
 	if framer == nil {
 		framer = DefaultFramer
 	}
 	if formatter == nil {
-		formatter = UnixFormatter
+		formatter = n.format.formatter()
+	}
+	out := framer(formatter(m))
+	if n.stream && !strings.HasSuffix(out, "\n") {
+		out += "\n"
 	}
-	_, err := n.conn.Write([]byte(framer(formatter(p, hostname, tag, msg))))
+	defer setWriteDeadline(ctx, n.conn, n.writeTimeout)()
+	_, err := n.conn.Write([]byte(out))
 	return err
 }
 
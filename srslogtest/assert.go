@@ -0,0 +1,60 @@
+package srslogtest
+
+import (
+	"testing"
+	"time"
+
+	syslog "github.com/RackSec/srslog"
+)
+
+// WaitFor waits up to timeout for the server to receive n messages and
+// returns them. It fails the test immediately if they do not arrive.
+func (s *Server) WaitFor(t testing.TB, n int, timeout time.Duration) []Message {
+	t.Helper()
+	msgs, err := s.Wait(n, timeout)
+	if err != nil {
+		t.Fatalf("expected %d messages within %v, got %d", n, timeout, len(msgs))
+	}
+	return msgs
+}
+
+// AssertPriority reports an error if m does not have priority p.
+func AssertPriority(t testing.TB, m Message, p syslog.Priority) {
+	t.Helper()
+	if m.Priority != p {
+		t.Errorf("expected priority %d, got %d in %q", p, m.Priority, m.Raw)
+	}
+}
+
+// AssertTag reports an error if m does not have the given tag.
+func AssertTag(t testing.TB, m Message, tag string) {
+	t.Helper()
+	if m.Tag != tag {
+		t.Errorf("expected tag %q, got %q in %q", tag, m.Tag, m.Raw)
+	}
+}
+
+// AssertHostname reports an error if m does not have the given hostname.
+func AssertHostname(t testing.TB, m Message, hostname string) {
+	t.Helper()
+	if m.Hostname != hostname {
+		t.Errorf("expected hostname %q, got %q in %q", hostname, m.Hostname, m.Raw)
+	}
+}
+
+// AssertStructuredData reports an error if m does not carry exactly the
+// given STRUCTURED-DATA. Pass the empty string to assert that it has none.
+func AssertStructuredData(t testing.TB, m Message, sd string) {
+	t.Helper()
+	if m.StructuredData != sd {
+		t.Errorf("expected structured data %q, got %q in %q", sd, m.StructuredData, m.Raw)
+	}
+}
+
+// AssertContent reports an error if m does not have the given content.
+func AssertContent(t testing.TB, m Message, content string) {
+	t.Helper()
+	if m.Content != content {
+		t.Errorf("expected content %q, got %q in %q", content, m.Content, m.Raw)
+	}
+}
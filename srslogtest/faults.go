@@ -0,0 +1,280 @@
+package srslogtest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	syslog "github.com/RackSec/srslog"
+)
+
+var (
+	// ErrInjectedWrite is the default error returned by writes that fail
+	// because of Faults.WriteErrorRate.
+	ErrInjectedWrite = errors.New("srslogtest: injected write error")
+
+	// ErrInjectedReset is returned by the write that crosses
+	// Faults.ResetAfter, after which the connection is closed.
+	ErrInjectedReset = errors.New("srslogtest: injected connection reset")
+)
+
+// Faults describes the failures a FaultyDialer injects. The zero value
+// injects nothing.
+type Faults struct {
+	// DialError, if non-nil, is returned by every dial attempt.
+	DialError error
+
+	// Latency is added before every write. A write deadline that passes
+	// during the delay fails the write, as it would on a slow network.
+	Latency time.Duration
+
+	// WriteErrorRate is the probability, from 0 to 1, that a write fails
+	// with WriteError without sending anything.
+	WriteErrorRate float64
+
+	// WriteError is returned by injected write failures. It defaults to
+	// ErrInjectedWrite.
+	WriteError error
+
+	// PartialWrites makes every write of more than one byte send only the
+	// first half and return io.ErrShortWrite.
+	PartialWrites bool
+
+	// ResetAfter closes a connection once this many bytes have been
+	// written on it. Zero disables resets.
+	ResetAfter int
+
+	// Blackhole makes writes hang until the connection is closed or its
+	// write deadline passes, like a collector that stopped reading.
+	Blackhole bool
+}
+
+// FaultyDialer dials real connections and wraps them so that they
+// misbehave according to its Faults. Its Dial method can be passed to
+// srslog.DialWithCustomDialer. Faults can be changed at any time with
+// SetFaults and apply to connections that are already open.
+type FaultyDialer struct {
+	network string
+	dial    syslog.DialFunc
+
+	mu     sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+	dials  int
+}
+
+// NewFaultyDialer returns a FaultyDialer that connects over network, which
+// is what the dial function receives instead of the "custom" network
+// srslog passes along. If dial is nil, net.Dial is used.
+func NewFaultyDialer(network string, dial syslog.DialFunc, faults Faults) *FaultyDialer {
+	if dial == nil {
+		dial = net.Dial
+	}
+	return &FaultyDialer{
+		network: network,
+		dial:    dial,
+		faults:  faults,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetFaults replaces the faults injected from now on.
+func (d *FaultyDialer) SetFaults(f Faults) {
+	d.mu.Lock()
+	d.faults = f
+	d.mu.Unlock()
+}
+
+// Faults returns the faults currently being injected.
+func (d *FaultyDialer) Faults() Faults {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.faults
+}
+
+// Dials returns the number of dial attempts made so far, including the
+// ones that failed.
+func (d *FaultyDialer) Dials() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials
+}
+
+// Dial connects to addr, ignoring network in favour of the one the
+// FaultyDialer was created with. It satisfies srslog.DialFunc.
+func (d *FaultyDialer) Dial(network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dials++
+	dialErr := d.faults.DialError
+	d.mu.Unlock()
+	if dialErr != nil {
+		return nil, dialErr
+	}
+
+	c, err := d.dial(d.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyConn{Conn: c, dialer: d, closed: make(chan struct{}), deadlineSet: make(chan struct{})}, nil
+}
+
+// shouldFail decides whether a write fails according to rate.
+func (d *FaultyDialer) shouldFail(rate float64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return rate > 0 && d.rand.Float64() < rate
+}
+
+// faultyConn is a net.Conn whose writes are subject to the faults of the
+// dialer that created it.
+type faultyConn struct {
+	net.Conn
+	dialer *FaultyDialer
+
+	mu       sync.Mutex
+	written  int
+	deadline time.Time
+
+	// closed and replaced whenever the deadline changes, to wake writes
+	// waiting on the old one
+	deadlineSet chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	f := c.dialer.Faults()
+
+	if f.Latency > 0 {
+		if err := c.wait(f.Latency); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.Blackhole {
+		return 0, c.wait(0)
+	}
+
+	if c.dialer.shouldFail(f.WriteErrorRate) {
+		if f.WriteError != nil {
+			return 0, f.WriteError
+		}
+		return 0, ErrInjectedWrite
+	}
+
+	var short bool
+	if f.PartialWrites && len(b) > 1 {
+		b = b[:len(b)/2]
+		short = true
+	}
+
+	if f.ResetAfter > 0 {
+		c.mu.Lock()
+		remaining := f.ResetAfter - c.written
+		c.mu.Unlock()
+		if len(b) >= remaining {
+			n := 0
+			if remaining > 0 {
+				n, _ = c.Conn.Write(b[:remaining])
+			}
+			c.addWritten(n)
+			c.Close()
+			return n, ErrInjectedReset
+		}
+	}
+
+	n, err := c.Conn.Write(b)
+	c.addWritten(n)
+	if err == nil && short {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+func (c *faultyConn) addWritten(n int) {
+	c.mu.Lock()
+	c.written += n
+	c.mu.Unlock()
+}
+
+// wait blocks until d has passed, the connection is closed or the write
+// deadline passes, and returns nil only in the first case. A d of zero
+// waits for the connection or the deadline alone. Deadlines changed while
+// waiting take effect immediately, as on a real connection.
+func (c *faultyConn) wait(d time.Duration) error {
+	var elapsed <-chan time.Time
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		elapsed = t.C
+	}
+
+	for {
+		c.mu.Lock()
+		deadline, changed := c.deadline, c.deadlineSet
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var t *time.Timer
+		if !deadline.IsZero() {
+			t = time.NewTimer(time.Until(deadline))
+			timeout = t.C
+		}
+
+		var err error
+		select {
+		case <-elapsed:
+		case <-c.closed:
+			err = c.closedError()
+		case <-timeout:
+			err = &net.OpError{Op: "write", Net: c.dialer.network, Addr: c.RemoteAddr(), Err: os.ErrDeadlineExceeded}
+		case <-changed:
+			if t != nil {
+				t.Stop()
+			}
+			continue
+		}
+		if t != nil {
+			t.Stop()
+		}
+		return err
+	}
+}
+
+func (c *faultyConn) closedError() error {
+	return &net.OpError{Op: "write", Net: c.dialer.network, Addr: c.RemoteAddr(), Err: net.ErrClosed}
+}
+
+func (c *faultyConn) SetDeadline(t time.Time) error {
+	c.setDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *faultyConn) SetWriteDeadline(t time.Time) error {
+	c.setDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// setDeadline records the write deadline and wakes writes waiting on the
+// previous one.
+func (c *faultyConn) setDeadline(t time.Time) {
+	c.mu.Lock()
+	c.deadline = t
+	close(c.deadlineSet)
+	c.deadlineSet = make(chan struct{})
+	c.mu.Unlock()
+}
+
+func (c *faultyConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.Conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,201 @@
+package srslogtest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	syslog "github.com/RackSec/srslog"
+)
+
+func newFaultyWriter(t *testing.T, faults Faults) (*Server, *FaultyDialer, *syslog.Writer) {
+	s, err := NewServer("tcp")
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	d := NewFaultyDialer("tcp", nil, faults)
+	w, err := syslog.DialWithCustomDialer("custom", s.Addr, syslog.LOG_ERR, "faulty", d.Dial)
+	if err != nil {
+		s.Close()
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return s, d, w
+}
+
+func TestFaultyDialerNoFaults(t *testing.T) {
+	s, d, w := newFaultyWriter(t, Faults{})
+	defer s.Close()
+	defer w.Close()
+
+	w.Err("fine")
+	msgs := s.WaitFor(t, 1, time.Second)
+	AssertContent(t, msgs[0], "fine")
+	if d.Dials() != 1 {
+		t.Errorf("expected one dial, got %d", d.Dials())
+	}
+}
+
+func TestFaultyDialerDialError(t *testing.T) {
+	boom := errors.New("boom")
+	d := NewFaultyDialer("tcp", nil, Faults{DialError: boom})
+	_, err := syslog.DialWithCustomDialer("custom", "127.0.0.1:0", syslog.LOG_ERR, "faulty", d.Dial)
+	if err != boom {
+		t.Errorf("expected the injected dial error, got %v", err)
+	}
+}
+
+func TestFaultyDialerWriteErrors(t *testing.T) {
+	s, d, w := newFaultyWriter(t, Faults{})
+	defer s.Close()
+	defer w.Close()
+
+	// Every write fails, including the one after the Writer reconnects.
+	d.SetFaults(Faults{WriteErrorRate: 1})
+	if err := w.Err("lost"); err != ErrInjectedWrite {
+		t.Errorf("expected ErrInjectedWrite, got %v", err)
+	}
+	if d.Dials() != 2 {
+		t.Errorf("expected the writer to redial once, got %d dials", d.Dials())
+	}
+
+	d.SetFaults(Faults{})
+	w.Err("recovered")
+	msgs := s.WaitFor(t, 1, time.Second)
+	AssertContent(t, msgs[0], "recovered")
+}
+
+func TestFaultyDialerPartialWrites(t *testing.T) {
+	d := NewFaultyDialer("tcp", nil, Faults{PartialWrites: true})
+	c, l := dialFaulty(t, d)
+	defer l.Close()
+	defer c.Close()
+
+	n, err := c.Write([]byte("abcd"))
+	if n != 2 || err != io.ErrShortWrite {
+		t.Errorf("expected a short write of 2 bytes, got %d, %v", n, err)
+	}
+}
+
+func TestFaultyDialerResetAfter(t *testing.T) {
+	d := NewFaultyDialer("tcp", nil, Faults{ResetAfter: 6})
+	c, l := dialFaulty(t, d)
+	defer l.Close()
+
+	if n, err := c.Write([]byte("abcd")); n != 4 || err != nil {
+		t.Errorf("expected first write to succeed, got %d, %v", n, err)
+	}
+	if n, err := c.Write([]byte("efgh")); n != 2 || err != ErrInjectedReset {
+		t.Errorf("expected a reset after 2 more bytes, got %d, %v", n, err)
+	}
+	if _, err := c.Write([]byte("ijkl")); err == nil {
+		t.Errorf("expected writes to fail after the reset")
+	}
+}
+
+func TestFaultyDialerBlackhole(t *testing.T) {
+	d := NewFaultyDialer("tcp", nil, Faults{Blackhole: true})
+	c, l := dialFaulty(t, d)
+	defer l.Close()
+
+	c.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	start := time.Now()
+	_, err := c.Write([]byte("abcd"))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("write returned before its deadline")
+	}
+
+	c.SetWriteDeadline(time.Time{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.Close()
+	}()
+	if _, err := c.Write([]byte("abcd")); err == nil {
+		t.Errorf("expected the write to fail once the connection closed")
+	}
+}
+
+func TestFaultyDialerBlackholeDeadlineChange(t *testing.T) {
+	d := NewFaultyDialer("tcp", nil, Faults{Blackhole: true})
+	c, l := dialFaulty(t, d)
+	defer l.Close()
+	defer c.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.SetWriteDeadline(time.Now())
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Write([]byte("abcd"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the write was not woken by the new deadline")
+	}
+}
+
+func TestFaultyDialerLatencyDeadline(t *testing.T) {
+	d := NewFaultyDialer("tcp", nil, Faults{Latency: time.Minute})
+	c, l := dialFaulty(t, d)
+	defer l.Close()
+	defer c.Close()
+
+	c.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	start := time.Now()
+	_, err := c.Write([]byte("abcd"))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("write returned after %v, expected it at its deadline", elapsed)
+	}
+}
+
+func TestFaultyDialerLatency(t *testing.T) {
+	d := NewFaultyDialer("tcp", nil, Faults{Latency: 20 * time.Millisecond})
+	c, l := dialFaulty(t, d)
+	defer l.Close()
+	defer c.Close()
+
+	start := time.Now()
+	if _, err := c.Write([]byte("abcd")); err != nil {
+		t.Errorf("failed to write: %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("expected the write to be delayed")
+	}
+}
+
+// dialFaulty opens a faulty connection to a listener that discards
+// everything it reads.
+func dialFaulty(t *testing.T, d *FaultyDialer) (net.Conn, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, c)
+		}
+	}()
+	c, err := d.Dial("custom", l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return c, l
+}
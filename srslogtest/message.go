@@ -0,0 +1,214 @@
+package srslogtest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	syslog "github.com/RackSec/srslog"
+)
+
+// Format identifies the wire format a received message was parsed as.
+type Format int
+
+const (
+	// FormatUnknown is used for messages that could not be parsed. Only
+	// Message.Raw and Message.Content are set.
+	FormatUnknown Format = iota
+	// FormatDefault is the output of srslog.DefaultFormatter.
+	FormatDefault
+	// FormatUnix is the output of srslog.UnixFormatter, without a hostname.
+	FormatUnix
+	// FormatRFC3164 is the output of srslog.RFC3164Formatter.
+	FormatRFC3164
+	// FormatRFC5424 is the output of srslog.RFC5424Formatter.
+	FormatRFC5424
+)
+
+// Message is a single syslog message as received by a Server.
+type Message struct {
+	// Raw is the message exactly as received, minus framing and the
+	// trailing newline.
+	Raw    string
+	Format Format
+
+	Priority  syslog.Priority
+	Timestamp string
+	Hostname  string
+
+	// Tag is the tag the Writer was created with. For RFC 5424 messages
+	// srslog sends the tag as the MSGID, so Tag is the MSGID field.
+	Tag string
+
+	// AppName is only set for RFC 5424 messages.
+	AppName string
+	PID     string
+
+	// StructuredData holds the raw STRUCTURED-DATA of an RFC 5424 message,
+	// or the empty string if it was the nil value "-".
+	StructuredData string
+
+	Content string
+}
+
+// Severity returns the severity part of the message priority.
+func (m Message) Severity() syslog.Priority {
+	return m.Priority & 0x07
+}
+
+// Facility returns the facility part of the message priority.
+func (m Message) Facility() syslog.Priority {
+	return m.Priority & 0xf8
+}
+
+// Parse parses a single message produced by one of the srslog formatters.
+// Messages that do not match any of them are returned with
+// FormatUnknown.
+func Parse(raw string) Message {
+	m := Message{Raw: raw, Content: raw}
+	if !strings.HasPrefix(raw, "<") {
+		return m
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 0 {
+		return m
+	}
+	p, err := strconv.Atoi(raw[1:end])
+	if err != nil {
+		return m
+	}
+	rest := raw[end+1:]
+
+	var ok bool
+	switch {
+	case strings.HasPrefix(rest, "1 "):
+		ok = parse5424(&m, rest[2:])
+	case strings.HasPrefix(rest, " "):
+		ok = parseDefault(&m, rest[1:])
+	default:
+		ok = parse3164(&m, rest)
+	}
+	if !ok {
+		return Message{Raw: raw, Content: raw}
+	}
+	m.Priority = syslog.Priority(p)
+	return m
+}
+
+// parse5424 parses "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG".
+func parse5424(m *Message, s string) bool {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return false
+	}
+	m.Format = FormatRFC5424
+	m.Timestamp = fields[0]
+	m.Hostname = fields[1]
+	m.AppName = fields[2]
+	m.PID = fields[3]
+	m.Tag = fields[4]
+
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		n := structuredDataLength(rest)
+		if n < 0 {
+			return false
+		}
+		m.StructuredData = rest[:n]
+		rest = rest[n:]
+	}
+	m.Content = strings.TrimPrefix(rest, " ")
+	return true
+}
+
+// structuredDataLength returns the length of the SD-ELEMENTs at the start
+// of s, honouring escaped characters inside PARAM-VALUEs, or -1 if s does
+// not start with a well-formed element.
+func structuredDataLength(s string) int {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		quoted := false
+		for i++; ; i++ {
+			if i >= len(s) {
+				return -1
+			}
+			c := s[i]
+			if quoted && c == '\\' {
+				i++
+				continue
+			}
+			if c == '"' {
+				quoted = !quoted
+			} else if c == ']' && !quoted {
+				i++
+				break
+			}
+		}
+	}
+	if i == 0 {
+		return -1
+	}
+	return i
+}
+
+// parseDefault parses "TIMESTAMP HOSTNAME TAG[PID]: MSG".
+func parseDefault(m *Message, s string) bool {
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) < 3 {
+		return false
+	}
+	m.Format = FormatDefault
+	m.Timestamp = fields[0]
+	m.Hostname = fields[1]
+	return parseTagAndContent(m, fields[2])
+}
+
+// parse3164 parses "Mmm dd hh:mm:ss [HOSTNAME] TAG[PID]: MSG". The
+// hostname is absent in messages from srslog.UnixFormatter.
+func parse3164(m *Message, s string) bool {
+	if len(s) < len(time.Stamp)+1 || s[len(time.Stamp)] != ' ' {
+		return false
+	}
+	if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err != nil {
+		return false
+	}
+	m.Timestamp = s[:len(time.Stamp)]
+	s = s[len(time.Stamp)+1:]
+
+	fields := strings.SplitN(s, " ", 2)
+	if strings.HasSuffix(fields[0], ":") || strings.Contains(fields[0], "[") {
+		m.Format = FormatUnix
+		return parseTagAndContent(m, s)
+	}
+	if len(fields) < 2 {
+		return false
+	}
+	m.Format = FormatRFC3164
+	m.Hostname = fields[0]
+	return parseTagAndContent(m, fields[1])
+}
+
+// parseTagAndContent parses "TAG[PID]: MSG", where the PID is optional.
+func parseTagAndContent(m *Message, s string) bool {
+	colon := strings.Index(s, ": ")
+	if colon < 0 {
+		if !strings.HasSuffix(s, ":") {
+			return false
+		}
+		colon = len(s) - 1
+	}
+	tag := s[:colon]
+	if open := strings.IndexByte(tag, '['); open >= 0 && strings.HasSuffix(tag, "]") {
+		m.PID = tag[open+1 : len(tag)-1]
+		tag = tag[:open]
+	}
+	m.Tag = tag
+	if colon+2 <= len(s) {
+		m.Content = s[colon+2:]
+	} else {
+		m.Content = ""
+	}
+	return true
+}
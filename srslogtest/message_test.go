@@ -0,0 +1,58 @@
+package srslogtest
+
+import (
+	"testing"
+
+	syslog "github.com/RackSec/srslog"
+)
+
+func TestParseFormatters(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        syslog.Formatter
+		format   Format
+		hostname string
+	}{
+		{"default", syslog.DefaultFormatter, FormatDefault, "host"},
+		{"unix", syslog.UnixFormatter, FormatUnix, ""},
+		{"rfc 3164", syslog.RFC3164Formatter, FormatRFC3164, "host"},
+		{"rfc 5424", syslog.RFC5424Formatter, FormatRFC5424, "host"},
+	}
+
+	for _, test := range tests {
+		m := Parse(test.f(syslog.LOG_DAEMON|syslog.LOG_NOTICE, "host", "tag", "some: content"))
+		if m.Format != test.format {
+			t.Errorf("%s: expected format %v, got %v", test.name, test.format, m.Format)
+		}
+		AssertPriority(t, m, syslog.LOG_DAEMON|syslog.LOG_NOTICE)
+		AssertHostname(t, m, test.hostname)
+		AssertTag(t, m, "tag")
+		AssertContent(t, m, "some: content")
+		if m.PID == "" {
+			t.Errorf("%s: expected a pid in %q", test.name, m.Raw)
+		}
+		if m.Severity() != syslog.LOG_NOTICE || m.Facility() != syslog.LOG_DAEMON {
+			t.Errorf("%s: wrong severity or facility in %q", test.name, m.Raw)
+		}
+	}
+}
+
+func TestParseStructuredData(t *testing.T) {
+	m := Parse(`<14>1 2017-01-01T00:00:00Z host app 1 tag [a@1 k="v \"]\""][b@1] msg`)
+	AssertStructuredData(t, m, `[a@1 k="v \"]\""][b@1]`)
+	AssertContent(t, m, "msg")
+
+	m = Parse(`<14>1 2017-01-01T00:00:00Z host app 1 tag - msg`)
+	AssertStructuredData(t, m, "")
+	AssertContent(t, m, "msg")
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, raw := range []string{"", "hello", "<x>hello", "<13>garbage"} {
+		m := Parse(raw)
+		if m.Format != FormatUnknown {
+			t.Errorf("expected %q to be unknown, got %v", raw, m.Format)
+		}
+		AssertContent(t, m, raw)
+	}
+}
@@ -0,0 +1,291 @@
+// Package srslogtest provides an in-process syslog collector for testing
+// code that sends messages with srslog.
+package srslogtest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake syslog collector listening on a local address. Every
+// message it receives is parsed and recorded, so tests can wait for and
+// inspect what a srslog.Writer sent.
+type Server struct {
+	// Network is the network to pass to srslog.Dial. For TLS servers this is
+	// "tcp+tls".
+	Network string
+
+	// Addr is the address to pass to srslog.Dial.
+	Addr string
+
+	// TLSConfig is a client configuration that trusts the server's
+	// self-signed certificate. It is nil unless Network is "tcp+tls".
+	TLSConfig *tls.Config
+
+	listener net.Listener
+	packet   net.PacketConn
+	dir      string
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	messages []Message
+	notify   chan struct{}
+	closed   bool
+}
+
+// NewServer starts a fake collector on the given network, which must be
+// one of "udp", "tcp", "tcp+tls", "unix" or "unixgram". Network addresses
+// are always on the loopback interface; Unix sockets are created in a
+// fresh temporary directory that is removed by Close.
+func NewServer(network string) (*Server, error) {
+	s := &Server{
+		Network: network,
+		conns:   make(map[net.Conn]struct{}),
+		notify:  make(chan struct{}),
+	}
+
+	var err error
+	switch network {
+	case "udp":
+		s.packet, err = net.ListenPacket("udp", "127.0.0.1:0")
+	case "tcp":
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	case "tcp+tls":
+		var serverConfig *tls.Config
+		serverConfig, s.TLSConfig, err = NewTLSConfig("127.0.0.1")
+		if err == nil {
+			s.listener, err = tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+		}
+	case "unix", "unixgram":
+		s.dir, err = ioutil.TempDir("", "srslogtest")
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(s.dir, "log.sock")
+		if network == "unix" {
+			s.listener, err = net.Listen(network, path)
+		} else {
+			s.packet, err = net.ListenPacket(network, path)
+		}
+	default:
+		return nil, fmt.Errorf("srslogtest: unsupported network %q", network)
+	}
+	if err != nil {
+		s.removeDir()
+		return nil, err
+	}
+
+	if s.packet != nil {
+		s.Addr = s.packet.LocalAddr().String()
+		s.wg.Add(1)
+		go s.servePacket()
+	} else {
+		s.Addr = s.listener.Addr().String()
+		s.wg.Add(1)
+		go s.serveStream()
+	}
+	return s, nil
+}
+
+// Close stops the server, closes all client connections and waits for the
+// server's goroutines to exit. Messages received so far remain available.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	var err error
+	if s.packet != nil {
+		err = s.packet.Close()
+	} else {
+		err = s.listener.Close()
+	}
+	s.wg.Wait()
+	s.removeDir()
+	return err
+}
+
+// Messages returns a copy of every message received so far, in the order
+// they arrived.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset discards every message received so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.messages = nil
+	s.mu.Unlock()
+}
+
+// ErrTimeout is returned by Wait when fewer messages than requested arrive
+// before the timeout.
+var ErrTimeout = errors.New("srslogtest: timed out waiting for messages")
+
+// Wait blocks until at least n messages have been received or timeout
+// elapses, and returns the messages received so far. The error is
+// ErrTimeout if fewer than n messages arrived in time.
+func (s *Server) Wait(n int, timeout time.Duration) ([]Message, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		if len(s.messages) >= n {
+			msgs := append([]Message(nil), s.messages...)
+			s.mu.Unlock()
+			return msgs, nil
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline.C:
+			return s.Messages(), ErrTimeout
+		}
+	}
+}
+
+// record parses and stores a single raw message and wakes up any waiters.
+func (s *Server) record(raw string) {
+	m := Parse(raw)
+	s.mu.Lock()
+	s.messages = append(s.messages, m)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// servePacket reads datagrams until the socket is closed. Each datagram
+// holds exactly one message.
+func (s *Server) servePacket() {
+	defer s.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := s.packet.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.record(strings.TrimRight(string(buf[:n]), "\n"))
+	}
+}
+
+// serveStream accepts connections until the listener is closed.
+func (s *Server) serveStream() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func(c net.Conn) {
+			defer s.wg.Done()
+			s.serveConn(c)
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			c.Close()
+		}(c)
+	}
+}
+
+// serveConn reads messages from a stream connection. Both newline
+// delimited messages and RFC 5425 octet-counted frames are accepted; the
+// framing is detected per message.
+func (s *Server) serveConn(c net.Conn) {
+	r := bufio.NewReader(c)
+	for {
+		raw, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		s.record(raw)
+	}
+}
+
+// maxFrameLen is the largest octet-counted frame the server accepts, the
+// same limit srslog applies to RELP frames. Larger counts are treated as a
+// broken stream rather than allocated.
+const maxFrameLen = 128 * 1024
+
+// readFrame reads one message from r. A message starting with a digit is
+// an octet-counted frame; anything else is terminated by a newline.
+func readFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] < '0' || b[0] > '9' {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(line, "\n"), nil
+	}
+
+	var prefix []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == ' ' {
+			break
+		}
+		// the count of a frame within maxFrameLen has at most 6 digits
+		if len(prefix) == 6 {
+			return "", fmt.Errorf("srslogtest: frame length %q is too long", prefix)
+		}
+		prefix = append(prefix, c)
+	}
+	length, err := strconv.Atoi(string(prefix))
+	if err != nil {
+		return "", err
+	}
+	if length > maxFrameLen {
+		return "", fmt.Errorf("srslogtest: frame length %d exceeds %d", length, maxFrameLen)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf), "\n"), nil
+}
+
+func (s *Server) removeDir() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
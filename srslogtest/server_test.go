@@ -0,0 +1,132 @@
+package srslogtest
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	syslog "github.com/RackSec/srslog"
+)
+
+func TestServerNetworks(t *testing.T) {
+	for _, network := range []string{"udp", "tcp", "tcp+tls", "unix", "unixgram"} {
+		s, err := NewServer(network)
+		if err != nil {
+			t.Fatalf("%s: failed to start server: %v", network, err)
+		}
+
+		w, err := syslog.DialWithTLSConfig(s.Network, s.Addr, syslog.LOG_USER|syslog.LOG_INFO, "srslogtest", s.TLSConfig)
+		if err != nil {
+			s.Close()
+			t.Fatalf("%s: failed to dial: %v", network, err)
+		}
+		w.SetHostname("testhost")
+		if err := w.Warning("hello"); err != nil {
+			t.Errorf("%s: failed to write: %v", network, err)
+		}
+		if err := w.Info("world"); err != nil {
+			t.Errorf("%s: failed to write: %v", network, err)
+		}
+
+		msgs := s.WaitFor(t, 2, time.Second)
+		AssertPriority(t, msgs[0], syslog.LOG_USER|syslog.LOG_WARNING)
+		AssertTag(t, msgs[0], "srslogtest")
+		if network == "unix" || network == "unixgram" {
+			// Local sockets use the UnixFormatter, which omits the hostname.
+			AssertHostname(t, msgs[0], "")
+		} else {
+			AssertHostname(t, msgs[0], "testhost")
+		}
+		AssertContent(t, msgs[0], "hello")
+		AssertContent(t, msgs[1], "world")
+
+		w.Close()
+		s.Close()
+	}
+}
+
+func TestServerOctetCounting(t *testing.T) {
+	s, err := NewServer("tcp")
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Close()
+
+	w, err := syslog.Dial(s.Network, s.Addr, syslog.LOG_LOCAL0|syslog.LOG_ERR, "framed")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.SetFramer(syslog.RFC5425MessageLengthFramer)
+	w.SetFormatter(syslog.RFC5424Formatter)
+
+	w.Err("multi\nline")
+	w.Err("second")
+
+	msgs := s.WaitFor(t, 2, time.Second)
+	AssertContent(t, msgs[0], "multi\nline")
+	AssertTag(t, msgs[1], "framed")
+	AssertPriority(t, msgs[1], syslog.LOG_LOCAL0|syslog.LOG_ERR)
+}
+
+func TestReadFrameLength(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("5 hello3 abc"))
+	for _, want := range []string{"hello", "abc"} {
+		if got, err := readFrame(r); got != want || err != nil {
+			t.Errorf("expected %q, got %q, %v", want, got, err)
+		}
+	}
+
+	for _, frame := range []string{"131073 x", "999999999 x", strings.Repeat("9", 1<<20)} {
+		if _, err := readFrame(bufio.NewReader(strings.NewReader(frame))); err == nil {
+			t.Errorf("should fail on the frame length of %.20q", frame)
+		}
+	}
+}
+
+func TestServerWaitTimeout(t *testing.T) {
+	s, err := NewServer("udp")
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Close()
+
+	msgs, err := s.Wait(1, 10*time.Millisecond)
+	if err != ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("expected no messages, got %v", msgs)
+	}
+}
+
+func TestServerReset(t *testing.T) {
+	s, err := NewServer("udp")
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Close()
+
+	w, err := syslog.Dial(s.Network, s.Addr, syslog.LOG_ERR, "tag")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("one")
+	s.WaitFor(t, 1, time.Second)
+	s.Reset()
+	if len(s.Messages()) != 0 {
+		t.Errorf("expected Reset to discard messages")
+	}
+	w.Err("two")
+	msgs := s.WaitFor(t, 1, time.Second)
+	AssertContent(t, msgs[0], "two")
+}
+
+func TestNewServerUnsupportedNetwork(t *testing.T) {
+	if _, err := NewServer("sctp"); err == nil {
+		t.Errorf("should fail on an unsupported network")
+	}
+}
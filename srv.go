@@ -0,0 +1,236 @@
+package srslog
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSRVUnavailable is returned when the SRV records of a domain say that
+// it offers no syslog service, or it has no usable records.
+var ErrSRVUnavailable = errors.New("srslog: no syslog service in SRV records")
+
+// A Resolver looks up SRV records for the "srv" and "srv+tls" networks.
+// *net.Resolver implements it, and net.DefaultResolver is used unless
+// another one is set with WithResolver.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// WithResolver sets the Resolver used by the "srv" and "srv+tls"
+// networks, so that tests can use a fake one.
+func WithResolver(r Resolver) Option {
+	return func(w *Writer) error {
+		w.resolver = r
+		return nil
+	}
+}
+
+// WithSRVRefresh makes a Writer on the "srv" or "srv+tls" network look up
+// its SRV records again every d while it is connected. If the target in
+// use is no longer listed, or a target of a higher priority appeared, the
+// connection is closed and the next write connects to the new best
+// target. Records are always looked up again on reconnect.
+func WithSRVRefresh(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.srvRefresh = &srvRefresher{interval: d, stop: make(chan struct{})}
+		return nil
+	}
+}
+
+// srvRefresher runs the background lookups of WithSRVRefresh, started once
+// the Writer first connects.
+type srvRefresher struct {
+	interval time.Duration
+	stop     chan struct{}
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// close stops the background lookups.
+func (r *srvRefresher) close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// srvService returns the SRV service and the network of the targets for
+// the "srv" and "srv+tls" networks.
+func (w *Writer) srvService() (service, network string) {
+	if w.network == "srv+tls" {
+		return "syslog-tls", "tcp+tls"
+	}
+	return "syslog", "tcp"
+}
+
+// lookupSRV returns the SRV records for raddr in the order they should be
+// tried.
+func (w *Writer) lookupSRV(ctx context.Context) ([]*net.SRV, error) {
+	resolver := w.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	service, _ := w.srvService()
+	_, records, err := resolver.LookupSRV(ctx, service, "tcp", w.raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record with the target "." means there is decidedly no
+	// service at this domain (RFC 2782).
+	var usable []*net.SRV
+	for _, r := range records {
+		if r.Target != "." && r.Target != "" {
+			usable = append(usable, r)
+		}
+	}
+	if len(usable) == 0 {
+		return nil, ErrSRVUnavailable
+	}
+	return orderSRV(usable), nil
+}
+
+// srvDialer looks up the SRV records of raddr and connects to the first
+// target that accepts a connection, and is used for the "srv" and
+// "srv+tls" network types. The "srv+tls" targets are verified against
+// their own host names unless the TLS configuration sets a ServerName.
+func (w *Writer) srvDialer(ctx context.Context) (serverConn, string, error) {
+	records, err := w.lookupSRV(ctx)
+	if err != nil {
+		return nil, w.getHostname(), err
+	}
+
+	_, network := w.srvService()
+	failed := &FailoverError{}
+	for _, r := range records {
+		m := w.memberWriter(Endpoint{Network: network, Addr: srvAddr(r), TLSConfig: w.tlsConfig})
+		sc, hostname, err := w.dialMember(ctx, m)
+		if err != nil {
+			failed.Errors = append(failed.Errors, err)
+			if contextErr(ctx) != nil {
+				break
+			}
+			continue
+		}
+
+		w.mu.Lock()
+		w.srvTarget = r
+		w.mu.Unlock()
+		if w.srvRefresh != nil {
+			w.srvRefresh.startOnce.Do(func() { go w.refreshSRV() })
+		}
+		return sc, hostname, nil
+	}
+	return nil, w.getHostname(), failed
+}
+
+// refreshSRV periodically looks up the SRV records again and drops the
+// connection when it no longer goes to the best target.
+func (w *Writer) refreshSRV() {
+	r := w.srvRefresh
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.RLock()
+		conn, target := w.conn, w.srvTarget
+		w.mu.RUnlock()
+		if conn == nil || target == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		records, err := w.lookupSRV(ctx)
+		cancel()
+		if err != nil || !srvStale(target, records) {
+			continue
+		}
+
+		w.mu.Lock()
+		current := w.conn == conn
+		if current {
+			w.conn = nil
+		}
+		w.mu.Unlock()
+		if current {
+			conn.close()
+		}
+	}
+}
+
+// srvStale reports whether target is missing from records, or records
+// hold a target of a higher priority.
+func srvStale(target *net.SRV, records []*net.SRV) bool {
+	listed := false
+	for _, r := range records {
+		if r.Priority < target.Priority {
+			return true
+		}
+		if srvAddr(r) == srvAddr(target) {
+			listed = true
+		}
+	}
+	return !listed
+}
+
+func srvAddr(r *net.SRV) string {
+	return net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port)))
+}
+
+// orderSRV returns records sorted by priority, and in a random order
+// weighted by weight within each priority, as described in RFC 2782.
+func orderSRV(records []*net.SRV) []*net.SRV {
+	sorted := append([]*net.SRV(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	ordered := make([]*net.SRV, 0, len(sorted))
+	for i := 0; i < len(sorted); {
+		j := i
+		for j < len(sorted) && sorted[j].Priority == sorted[i].Priority {
+			j++
+		}
+		ordered = append(ordered, shuffleSRV(sorted[i:j])...)
+		i = j
+	}
+	return ordered
+}
+
+// shuffleSRV orders records of the same priority by repeatedly picking one
+// with a probability proportional to its weight. Records of weight zero
+// come first, so they are only picked when the random number is zero.
+func shuffleSRV(group []*net.SRV) []*net.SRV {
+	remaining := append([]*net.SRV(nil), group...)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		return remaining[i].Weight == 0 && remaining[j].Weight != 0
+	})
+
+	ordered := make([]*net.SRV, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0
+		for _, r := range remaining {
+			total += int(r.Weight)
+		}
+		pick := rand.Intn(total + 1)
+		sum := 0
+		for k, r := range remaining {
+			sum += int(r.Weight)
+			if sum >= pick {
+				ordered = append(ordered, r)
+				remaining = append(remaining[:k], remaining[k+1:]...)
+				break
+			}
+		}
+	}
+	return ordered
+}
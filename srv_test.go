@@ -0,0 +1,171 @@
+package srslog
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers SRV lookups from a record set that tests can change.
+type fakeResolver struct {
+	mu      sync.Mutex
+	records []*net.SRV
+	lookups []string
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups = append(r.lookups, "_"+service+"._"+proto+"."+name)
+	return "", r.records, nil
+}
+
+func (r *fakeResolver) set(records ...*net.SRV) {
+	r.mu.Lock()
+	r.records = records
+	r.mu.Unlock()
+}
+
+// srvRecord returns a record for a server listening on addr.
+func srvRecord(t *testing.T, addr string, priority, weight uint16) *net.SRV {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("bad address %q: %v", addr, err)
+	}
+	p, _ := strconv.Atoi(port)
+	return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority, Weight: weight}
+}
+
+func TestSRVDialPrefersPriority(t *testing.T) {
+	backup := startTestStreamServer(t, "127.0.0.1:0")
+	defer backup.kill()
+	preferred := startTestStreamServer(t, "127.0.0.1:0")
+	defer preferred.kill()
+
+	r := &fakeResolver{}
+	r.set(srvRecord(t, backup.addr, 20, 0), srvRecord(t, preferred.addr, 10, 0))
+	w, err := DialWithOptions("srv", "example.com", LOG_ERR, "tag", WithResolver(r))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	w.Err("to preferred")
+	preferred.receive(t, "to preferred")
+	if r.lookups[0] != "_syslog._tcp.example.com" {
+		t.Errorf("unexpected lookup %q", r.lookups[0])
+	}
+
+	tlsWriter := &Writer{network: "srv+tls", raddr: "example.com", resolver: r}
+	tlsWriter.lookupSRV(context.Background())
+	if last := r.lookups[len(r.lookups)-1]; last != "_syslog-tls._tcp.example.com" {
+		t.Errorf("unexpected lookup %q", last)
+	}
+}
+
+func TestSRVReResolvesOnReconnect(t *testing.T) {
+	old := startTestStreamServer(t, "127.0.0.1:0")
+	moved := startTestStreamServer(t, "127.0.0.1:0")
+	defer moved.kill()
+
+	r := &fakeResolver{}
+	r.set(srvRecord(t, old.addr, 10, 0))
+	w, err := DialWithOptions("srv", "example.com", LOG_ERR, "tag", WithResolver(r))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+	w.Err("before move")
+	old.receive(t, "before move")
+
+	r.set(srvRecord(t, moved.addr, 10, 0))
+	old.kill()
+	// The first write after the server goes away may still be accepted by
+	// the kernel, so keep writing until one reconnects.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(moved.msgs) == 0 {
+		w.Err("after move")
+		if time.Now().After(deadline) {
+			t.Fatalf("did not follow the new SRV record")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	moved.receive(t, "after move")
+}
+
+func TestSRVRefresh(t *testing.T) {
+	old := startTestStreamServer(t, "127.0.0.1:0")
+	defer old.kill()
+	moved := startTestStreamServer(t, "127.0.0.1:0")
+	defer moved.kill()
+
+	r := &fakeResolver{}
+	r.set(srvRecord(t, old.addr, 10, 0))
+	w, err := DialWithOptions("srv", "example.com", LOG_ERR, "tag", WithResolver(r), WithSRVRefresh(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	r.set(srvRecord(t, moved.addr, 10, 0))
+	deadline := time.Now().Add(2 * time.Second)
+	for w.getConn() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("did not drop the connection to the stale target")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Err("after refresh")
+	moved.receive(t, "after refresh")
+}
+
+func TestSRVUnavailable(t *testing.T) {
+	r := &fakeResolver{}
+	r.set(&net.SRV{Target: ".", Port: 0})
+	if _, err := DialWithOptions("srv", "example.com", LOG_ERR, "tag", WithResolver(r)); err != ErrSRVUnavailable {
+		t.Errorf("expected ErrSRVUnavailable, got %v", err)
+	}
+}
+
+func TestSRVStale(t *testing.T) {
+	target := &net.SRV{Target: "a.", Port: 514, Priority: 10}
+	tests := []struct {
+		records []*net.SRV
+		stale   bool
+	}{
+		{[]*net.SRV{target}, false},
+		{[]*net.SRV{{Target: "b.", Port: 514, Priority: 10}, target}, false},
+		{[]*net.SRV{{Target: "b.", Port: 514, Priority: 10}}, true},
+		{[]*net.SRV{{Target: "b.", Port: 514, Priority: 5}, target}, true},
+	}
+	for i, test := range tests {
+		if got := srvStale(target, test.records); got != test.stale {
+			t.Errorf("%d: expected stale %v, got %v", i, test.stale, got)
+		}
+	}
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c.", Priority: 20, Weight: 0},
+		{Target: "light.", Priority: 10, Weight: 1},
+		{Target: "heavy.", Priority: 10, Weight: 99},
+	}
+
+	heavyFirst := 0
+	for i := 0; i < 1000; i++ {
+		ordered := orderSRV(records)
+		if len(ordered) != 3 || ordered[2].Target != "c." {
+			t.Fatalf("expected lower priorities last, got %v", ordered)
+		}
+		if ordered[0].Target == "heavy." {
+			heavyFirst++
+		}
+	}
+	if heavyFirst < 900 {
+		t.Errorf("expected the heavier target first most of the time, got %d/1000", heavyFirst)
+	}
+}
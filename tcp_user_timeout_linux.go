@@ -0,0 +1,19 @@
+package srslog
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeout is TCP_USER_TIMEOUT, which syscall only defines on some
+// architectures.
+const tcpUserTimeout = 0x12
+
+const tcpUserTimeoutSupported = true
+
+var errTCPUserTimeoutUnsupported = errors.New("srslog: TCP_USER_TIMEOUT is only supported on Linux")
+
+func setTCPUserTimeout(fd uintptr, d time.Duration) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(d/time.Millisecond))
+}
@@ -0,0 +1,49 @@
+package srslog
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func getsockopt(t *testing.T, w *Writer, level, opt int) int {
+	c := w.getConn().(*netConn).conn.(*net.TCPConn)
+	raw, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get raw conn: %v", err)
+	}
+	var value int
+	var serr error
+	raw.Control(func(fd uintptr) { value, serr = syscall.GetsockoptInt(int(fd), level, opt) })
+	if serr != nil {
+		t.Fatalf("getsockopt failed: %v", serr)
+	}
+	return value
+}
+
+func TestSocketOptions(t *testing.T) {
+	l := startSilentServer(t, "tcp", "127.0.0.1:0")
+	defer l.Close()
+
+	w, err := DialWithOptions("tcp", l.Addr().String(), LOG_ERR, "tag",
+		WithTCPUserTimeout(2500*time.Millisecond),
+		WithKeepAlive(net.KeepAliveConfig{Enable: true, Idle: 7 * time.Second, Interval: 3 * time.Second, Count: 4}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	if got := getsockopt(t, w, syscall.IPPROTO_TCP, tcpUserTimeout); got != 2500 {
+		t.Errorf("expected TCP_USER_TIMEOUT 2500, got %d", got)
+	}
+	if got := getsockopt(t, w, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); got != 1 {
+		t.Errorf("expected keep-alives to be enabled, got %d", got)
+	}
+	if got := getsockopt(t, w, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); got != 7 {
+		t.Errorf("expected TCP_KEEPIDLE 7, got %d", got)
+	}
+	if got := getsockopt(t, w, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT); got != 4 {
+		t.Errorf("expected TCP_KEEPCNT 4, got %d", got)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package srslog
+
+import (
+	"errors"
+	"time"
+)
+
+const tcpUserTimeoutSupported = false
+
+var errTCPUserTimeoutUnsupported = errors.New("srslog: TCP_USER_TIMEOUT is only supported on Linux")
+
+func setTCPUserTimeout(fd uintptr, d time.Duration) error {
+	return errTCPUserTimeoutUnsupported
+}
@@ -0,0 +1,136 @@
+package srslog
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// WithDialTimeout bounds how long connecting to the syslog server may
+// take, for the initial connection and every reconnect. Zero, the
+// default, means no timeout. For TLS it also bounds the handshake unless
+// WithTLSHandshakeTimeout is set. A DialContextFunc gets it as the deadline
+// of its context; a DialFunc is not bounded by it.
+func WithDialTimeout(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.dialTimeout = d
+		return nil
+	}
+}
+
+// WithTLSHandshakeTimeout bounds how long the TLS handshake may take once
+// the TCP connection is established.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.tlsHandshakeTimeout = d
+		return nil
+	}
+}
+
+// WithWriteTimeout bounds how long sending a single message may block.
+// A write that times out fails like any other write error, so the Writer
+// reconnects and retries it once instead of hanging on a collector that
+// stopped reading. Zero, the default, means no timeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(w *Writer) error {
+		w.writeTimeout = d
+		return nil
+	}
+}
+
+// deadliner is implemented by connections that support write deadlines.
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// setWriteDeadline arms the write deadline of conn for a write that
+// starts now: the earlier of timeout from now and the deadline of ctx, or
+// none if neither is set. If ctx can be cancelled, cancelling it
+// interrupts the write. The returned function must be called once the
+// write is done. Connections without deadline support are left alone.
+func setWriteDeadline(ctx context.Context, conn interface{}, timeout time.Duration) (stop func()) {
+	d, ok := conn.(deadliner)
+	if !ok {
+		return func() {}
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	d.SetWriteDeadline(deadline)
+
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopInterrupt := context.AfterFunc(ctx, func() {
+		d.SetWriteDeadline(time.Unix(1, 0))
+	})
+	return func() { stopInterrupt() }
+}
+
+// contextErr returns the error of ctx, treating a deadline that has passed
+// as exceeded even before ctx's own timer fires. Deadlines armed from ctx
+// can expire a moment earlier than ctx itself does.
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// netDialer returns a net.Dialer that honours the Writer's dial timeout
+// and TCP socket options.
+func (w *Writer) netDialer() *net.Dialer {
+	d := &net.Dialer{Timeout: w.dialTimeout, Control: w.controlSocket()}
+	if w.keepAlive != nil {
+		d.KeepAliveConfig = *w.keepAlive
+	}
+	return d
+}
+
+// dialTLS connects to addr over TCP and performs the TLS handshake,
+// honouring the dial and handshake timeouts.
+func (w *Writer) dialTLS(ctx context.Context, addr string) (net.Conn, error) {
+	raw, err := w.dialNet(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := w.tlsConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		// Verify the server against the host we dialed, as tls.Dial does.
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		} else {
+			config.ServerName = addr
+		}
+	}
+
+	timeout := w.tlsHandshakeTimeout
+	if timeout <= 0 {
+		timeout = w.dialTimeout
+	}
+	if timeout > 0 {
+		raw.SetDeadline(time.Now().Add(timeout))
+	}
+
+	c := tls.Client(raw, config)
+	if err := c.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	raw.SetDeadline(time.Time{})
+	return c, nil
+}
@@ -0,0 +1,145 @@
+package srslog
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSilentServer accepts connections but never reads from or writes
+// to them, like a collector that hangs.
+func startSilentServer(t *testing.T, network, addr string) net.Listener {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+	return l
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	l := startSilentServer(t, "tcp", "127.0.0.1:0")
+	defer l.Close()
+
+	start := time.Now()
+	_, err := DialWithOptions("tcp+tls", l.Addr().String(), LOG_ERR, "tag", WithTLSHandshakeTimeout(50*time.Millisecond))
+	if err == nil {
+		t.Fatalf("should fail when the handshake never completes")
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("handshake timeout was not honoured")
+	}
+}
+
+func TestDialTimeoutCoversHandshake(t *testing.T) {
+	l := startSilentServer(t, "tcp", "127.0.0.1:0")
+	defer l.Close()
+
+	start := time.Now()
+	if _, err := DialWithOptions("relp", l.Addr().String(), LOG_ERR, "tag", WithDialTimeout(50*time.Millisecond)); err == nil {
+		t.Fatalf("should fail when the server never responds")
+	}
+	if _, err := DialWithOptions("tcp+tls", l.Addr().String(), LOG_ERR, "tag",
+		WithDialTimeout(50*time.Millisecond), WithTLSConfig(&tls.Config{})); err == nil {
+		t.Fatalf("should fail when the handshake never completes")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("dial timeout was not honoured")
+	}
+}
+
+func TestDialTimeoutCustomDialer(t *testing.T) {
+	hang := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	start := time.Now()
+	_, err := DialWithOptions("custom", "", LOG_ERR, "tag", WithCustomDialContext(hang), WithDialTimeout(50*time.Millisecond))
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the dial to time out, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("dial timeout was not honoured")
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	f, err := ioutil.TempFile("", "srslog-timeout")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	path := f.Name()
+	f.Close()
+	os.Remove(path)
+	defer os.Remove(path)
+
+	l := startSilentServer(t, "unix", path)
+	defer l.Close()
+
+	w, err := DialWithOptions("unix", path, LOG_ERR, "tag", WithWriteTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer w.Close()
+
+	// Large enough to fill the socket buffers of a server that never reads.
+	msg := strings.Repeat("x", 8<<20)
+	start := time.Now()
+	if err := w.Err(msg); err == nil {
+		t.Errorf("should fail when the server stops reading")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("write timeout was not honoured")
+	}
+}
+
+type testDeadlineConn struct {
+	testLocalConn
+	deadline time.Time
+}
+
+func (c *testDeadlineConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func TestSetWriteDeadline(t *testing.T) {
+	c := &testDeadlineConn{}
+	setWriteDeadline(context.Background(), c, 0)
+	if !c.deadline.IsZero() {
+		t.Errorf("should not set a deadline without a timeout")
+	}
+
+	setWriteDeadline(context.Background(), c, time.Minute)
+	if c.deadline.Before(time.Now().Add(59 * time.Second)) {
+		t.Errorf("expected a deadline a minute from now, got %v", c.deadline)
+	}
+
+	// Connections without deadlines are left alone.
+	setWriteDeadline(context.Background(), testLocalConn{}, time.Minute)
+}
@@ -1,9 +1,13 @@
 package srslog
 
 import (
+	"context"
 	"crypto/tls"
+	"net"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 // A Writer is a connection to a syslog server.
@@ -15,13 +19,88 @@ type Writer struct {
 	raddr     string
 	tlsConfig *tls.Config
 	framer    Framer
-	formatter Formatter
+	formatter MessageFormatter
+	// set if formatter is a Formatter from another package, and so
+	// ignores the Timestamp and StructuredData of messages
+	plainFormatter bool
 
 	//non-nil if custom dialer set, used in getDialer
-	customDial DialFunc
+	customDial        DialFunc
+	customDialContext DialContextFunc
 
-	mu   sync.RWMutex // guards conn
+	mu   sync.RWMutex // guards conn, hostname, relp, relpWindow and journalFields
 	conn serverConn
+
+	// RELP state shared by successive connections, see relpDialer
+	relp       *relpSession
+	relpWindow int
+
+	// custom fields for the "journald" network
+	journalFields map[string]string
+
+	// sockets tried by unixDialer, see WithLocalSocketPaths
+	localPaths []string
+
+	// format for local connections without a Formatter, see WithLocalFormat
+	localFormat LocalFormat
+
+	// zero means no timeout, see WithDialTimeout and friends
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	writeTimeout        time.Duration
+
+	// endpoints of a Writer created with DialFailover
+	failover         *failoverGroup
+	failbackInterval time.Duration
+
+	// members of a Writer created with DialPool
+	pool           *poolGroup
+	rejoinInterval time.Duration
+
+	// SRV lookups of the "srv" and "srv+tls" networks
+	resolver   Resolver
+	srvRefresh *srvRefresher
+	srvTarget  *net.SRV // target in use, guarded by mu
+
+	// proxy for TCP connections, see WithProxy
+	proxy   *url.URL
+	noProxy string
+
+	// TCP socket options, see WithKeepAlive and WithTCPUserTimeout
+	keepAlive      *net.KeepAliveConfig
+	tcpUserTimeout time.Duration
+
+	// background reconnects, see WithRetryPolicy
+	retry          *reconnector
+	failFastWindow time.Duration
+
+	// queue of an asynchronous Writer, see WithAsync
+	async             *asyncQueue
+	asyncErrorHandler func(error)
+	closeTimeout      time.Duration
+	batchSize         int // see WithBatching
+	batchDelay        time.Duration
+
+	// disk spool for at-least-once delivery, see WithSpool
+	spool *spool
+
+	// circuit breaker, see WithCircuitBreaker
+	breaker             *breaker
+	breakerStateHandler func(from, to BreakerState)
+
+	// collapses repeated messages, see WithRepeatSuppression
+	repeats *repeatFilter
+
+	// rate limits and sampling, see WithSeverityRateLimit and WithSampling
+	limiter *rateLimiter
+
+	// severity thresholds, see SetLevel
+	levels levels
+
+	// Writer a derived Writer writes through, and the structured data it
+	// adds, see WithTag
+	parent         *Writer
+	structuredData []SDElement
 }
 
 // getConn provides access to the internal conn, protected by a mutex. The
@@ -41,8 +120,32 @@ func (w *Writer) setConn(c serverConn) {
 	w.mu.Unlock()
 }
 
+// setConnAndHostname updates the internal conn and the hostname a new
+// connection was made with, protected by a mutex.
+func (w *Writer) setConnAndHostname(c serverConn, hostname string) {
+	w.mu.Lock()
+	w.conn = c
+	w.hostname = hostname
+	w.mu.Unlock()
+}
+
+// getHostname returns the hostname for syslog messages, protected by a
+// mutex since SetHostname and reconnects change it.
+func (w *Writer) getHostname() string {
+	w.mu.RLock()
+	hostname := w.hostname
+	w.mu.RUnlock()
+	return hostname
+}
+
 // connect makes a connection to the syslog server.
 func (w *Writer) connect() (serverConn, error) {
+	return w.connectContext(context.Background())
+}
+
+// connectContext makes a connection to the syslog server, giving up when
+// ctx is done.
+func (w *Writer) connectContext(ctx context.Context) (serverConn, error) {
 	conn := w.getConn()
 	if conn != nil {
 		// ignore err from close, it makes sense to continue anyway
@@ -53,10 +156,9 @@ func (w *Writer) connect() (serverConn, error) {
 	var hostname string
 	var err error
 	dialer := w.getDialer()
-	conn, hostname, err = dialer.Call()
+	conn, hostname, err = dialer.Call(ctx)
 	if err == nil {
-		w.setConn(conn)
-		w.hostname = hostname
+		w.setConnAndHostname(conn, hostname)
 
 		return conn, nil
 	} else {
@@ -65,33 +167,130 @@ func (w *Writer) connect() (serverConn, error) {
 }
 
 // SetFormatter changes the formatter function for subsequent messages.
+// The Formatters of this package are replaced by their MessageFormatter
+// counterparts, so RFC5424Formatter sends the Timestamp and StructuredData
+// of messages. Other Formatters are not given either, so messages with
+// them fail with ErrOverrideUnsupported; use SetMessageFormatter to send
+// them.
 func (w *Writer) SetFormatter(f Formatter) {
-	w.formatter = f
+	w = w.root()
+	w.formatter, w.plainFormatter = nil, false
+	if mf := messageFormatterOf(f); mf != nil {
+		w.formatter = mf
+	} else if f != nil {
+		w.formatter, w.plainFormatter = f.message(), true
+	}
+}
+
+// SetMessageFormatter changes the formatter function for subsequent
+// messages, like SetFormatter, to one that is given whole messages.
+func (w *Writer) SetMessageFormatter(f MessageFormatter) {
+	w = w.root()
+	w.formatter, w.plainFormatter = f, false
 }
 
 // SetFramer changes the framer function for subsequent messages.
 func (w *Writer) SetFramer(f Framer) {
+	w = w.root()
 	w.framer = f
 }
 
-// SetHostname changes the hostname for syslog messages if needed.
+// SetRELPWindow changes the number of messages that may be sent over the
+// "relp" network without being acknowledged before writes block. It
+// defaults to DefaultRELPWindow.
+func (w *Writer) SetRELPWindow(window int) {
+	w = w.root()
+	w.mu.Lock()
+	w.relpWindow = window
+	conn := w.conn
+	w.mu.Unlock()
+
+	if rc, ok := conn.(*relpConn); ok && window > 0 {
+		rc.setWindow(window)
+	}
+}
+
+// SetHostname changes the hostname for syslog messages if needed. It is
+// safe to call while other goroutines write.
 func (w *Writer) SetHostname(hostname string) {
+	w = w.root()
+	w.mu.Lock()
 	w.hostname = hostname
+	w.mu.Unlock()
 }
 
 // Write sends a log message to the syslog daemon using the default priority
 // passed into `srslog.New` or the `srslog.Dial*` functions.
 func (w *Writer) Write(b []byte) (int, error) {
+	if !w.enabled(w.priority) {
+		return len(b), nil
+	}
 	return w.writeAndRetry(w.priority, string(b))
 }
 
 // WriteWithPriority sends a log message with a custom priority.
 func (w *Writer) WriteWithPriority(p Priority, b []byte) (int, error) {
+	if !w.enabled(p) {
+		return len(b), nil
+	}
 	return w.writeAndRetryWithPriority(p, string(b))
 }
 
-// Close closes a connection to the syslog daemon.
+// WriteContext is like Write, but gives up when ctx is cancelled or
+// expires, including while reconnecting, and returns the context's error.
+func (w *Writer) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if !w.enabled(w.priority) {
+		return len(b), nil
+	}
+	return w.writeAndRetryContext(ctx, w.priority, string(b))
+}
+
+// WriteWithPriorityContext is like WriteWithPriority, but gives up when ctx
+// is cancelled or expires.
+func (w *Writer) WriteWithPriorityContext(ctx context.Context, p Priority, b []byte) (int, error) {
+	if !w.enabled(p) {
+		return len(b), nil
+	}
+	return w.writeAndRetryContext(ctx, p, string(b))
+}
+
+// Close closes a connection to the syslog daemon. An asynchronous Writer
+// first sends the messages in its queue, waiting at most the close timeout.
+// Messages still in the spool, if any, stay on disk for the next Writer.
+// Closing a derived Writer, see WithTag, does nothing.
 func (w *Writer) Close() error {
+	if w.parent != nil {
+		return nil
+	}
+	if w.limiter != nil {
+		w.closeRateLimiter()
+	}
+	if w.repeats != nil {
+		w.closeRepeats()
+	}
+	if w.async != nil {
+		timeout := w.closeTimeout
+		if timeout <= 0 {
+			timeout = DefaultCloseTimeout
+		}
+		w.async.close(timeout)
+	}
+	if w.spool != nil {
+		w.spool.close()
+	}
+	if w.failover != nil {
+		w.failover.close()
+	}
+	if w.pool != nil {
+		w.pool.close()
+	}
+	if w.srvRefresh != nil {
+		w.srvRefresh.close()
+	}
+	if w.retry != nil {
+		w.retry.close()
+	}
+
 	conn := w.getConn()
 	if conn != nil {
 		err := conn.close()
@@ -168,29 +367,128 @@ func (w *Writer) writeAndRetry(severity Priority, s string) (int, error) {
 // writeAndRetryWithPriority differs from writeAndRetry in that it allows setting
 // of both the facility and the severity.
 func (w *Writer) writeAndRetryWithPriority(p Priority, s string) (int, error) {
+	return w.writeAndRetryContext(context.Background(), p, s)
+}
+
+// writeAndRetryContext is writeAndRetryWithPriority bounded by ctx. An
+// asynchronous Writer only queues the message, and ctx bounds waiting for
+// room in the queue.
+func (w *Writer) writeAndRetryContext(ctx context.Context, p Priority, s string) (int, error) {
+	return w.writeMessage(ctx, Message{Priority: p, Content: s})
+}
+
+// writeMessage passes a message through the level, rate limits and repeat
+// filter of the Writer, and sends or queues it.
+func (w *Writer) writeMessage(ctx context.Context, m Message) (int, error) {
+	if w.parent != nil {
+		return w.writeDerived(ctx, m)
+	}
+	if !w.enabled(m.Priority) {
+		return len(m.Content), nil
+	}
+	if err := contextErr(ctx); err != nil {
+		return 0, err
+	}
+	if err := w.checkOverrides(&m); err != nil {
+		return 0, err
+	}
+	if w.limiter != nil && !w.allowRate(m.Priority, w.tagOf(m), m.Content) {
+		return len(m.Content), nil
+	}
+	w.capture(&m)
+	if w.repeats != nil {
+		return w.writeRepeating(ctx, m)
+	}
+	return w.dispatch(ctx, m)
+}
+
+// dispatch queues a message on an asynchronous Writer, and delivers it on
+// others.
+func (w *Writer) dispatch(ctx context.Context, m Message) (int, error) {
+	if w.async != nil {
+		return w.async.enqueue(ctx, m)
+	}
+	return w.deliver(ctx, m)
+}
+
+// sendAndRetry writes a message, reconnecting and retrying once if the
+// write fails. Once ctx is done it neither writes nor reconnects.
+func (w *Writer) sendAndRetry(ctx context.Context, m Message) (int, error) {
+	if err := contextErr(ctx); err != nil {
+		return 0, err
+	}
+
 	conn := w.getConn()
 	if conn != nil {
-		if n, err := w.write(conn, p, s); err == nil {
+		n, err := w.write(ctx, conn, m)
+		if err == nil {
 			return n, err
 		}
+		if contextErr(ctx) != nil {
+			return 0, w.abandon(ctx, conn)
+		}
 	}
 
-	var err error
-	if conn, err = w.connect(); err != nil {
+	conn, err := w.redial(ctx, conn)
+	if err != nil {
 		return 0, err
 	}
-	return w.write(conn, p, s)
+	n, err := w.write(ctx, conn, m)
+	if err != nil && contextErr(ctx) != nil {
+		return 0, w.abandon(ctx, conn)
+	}
+	return n, err
+}
+
+// redial replaces failed, which may be nil, with a new connection: in the
+// background if the Writer has a RetryPolicy, otherwise right away.
+func (w *Writer) redial(ctx context.Context, failed serverConn) (serverConn, error) {
+	var conn serverConn
+	var err error
+	if w.retry != nil {
+		conn, err = w.reconnect(ctx, failed)
+	} else {
+		conn, err = w.connectContext(ctx)
+	}
+	if err != nil {
+		if contextErr(ctx) != nil {
+			return nil, contextErr(ctx)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// abandon drops a connection whose write was interrupted by ctx, since the
+// message may have been partly sent, and returns the context's error. The
+// next write reconnects. A healthy RELP connection is kept: its frames are
+// written whole or the connection fails, so an interrupted write only ever
+// gave up waiting for the window. A pool has already ejected the member
+// that was interrupted, and its other members are kept.
+func (w *Writer) abandon(ctx context.Context, conn serverConn) error {
+	if rc, ok := conn.(*relpConn); ok && rc.healthy() {
+		return contextErr(ctx)
+	}
+	if _, ok := conn.(*poolConn); ok {
+		return contextErr(ctx)
+	}
+	w.dropConn(conn)
+	return contextErr(ctx)
 }
 
 // write generates and writes a syslog formatted string. It formats the
-// message based on the current Formatter and Framer.
-func (w *Writer) write(conn serverConn, p Priority, msg string) (int, error) {
+// message based on the current Formatter and Framer, and the Writer's
+// hostname and tag unless the message overrides them.
+func (w *Writer) write(ctx context.Context, conn serverConn, m Message) (int, error) {
+	m = w.resolve(m)
+	msg := m.Content
 	// ensure it ends in a \n
 	if !strings.HasSuffix(msg, "\n") {
 		msg += "\n"
 	}
 
-	err := conn.writeString(w.framer, w.formatter, p, w.hostname, w.tag, msg)
+	m.Content = msg
+	err := conn.writeString(ctx, w.framer, w.formatter, &m)
 	if err != nil {
 		return 0, err
 	}